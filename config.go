@@ -15,6 +15,16 @@ const (
 	SpecEscape
 )
 
+type limitConstant uint8
+
+// Limit constants for Config methods.
+const (
+	LimitDepth    limitConstant = iota // nesting depth of operators
+	LimitInput                         // bytes of input, including expansions
+	LimitIncludes                      // number of files included
+	LimitSymbols                       // number of symbols
+)
+
 type opConstant uint8
 
 // Operator constants for Config methods.
@@ -26,12 +36,42 @@ const (
 	OpMacro
 	OpReset
 	OpSkip
+	OpSwitch
+	OpForeach
+	OpExport
+	OpClear
 )
 
+// opCustom is the constant of the first operator added by a program.
+const opCustom opConstant = 128
+
+// builtinOps lists built-in operators in documentation sequence.
+var builtinOps = []opConstant{OpClear, OpCond, OpDump, OpExport, OpForeach, OpImport, OpInclude, OpMacro, OpReset, OpSkip, OpSwitch}
+
+// customOp describes an operator added by a program.
+type customOp struct {
+	factory func(*Parser) Operator
+	doc     string
+}
+
 // Config holds configurable special characters and operator names.
 type Config struct {
-	specList [5]rune
-	opDict   map[string]opConstant
+	specList  [5]rune
+	modifier  rune // separates a symbol from a modifier in a reference
+	opDict    map[string]opConstant
+	opCustom  []customOp // operators added by the program, from opCustom
+	disabled  map[opConstant]bool
+	incRoots  []string        // directories permitted for include, nil for all
+	envNames  map[string]bool // variables permitted for import, nil for all
+	limits    [4]int
+	functions map[string]Function
+}
+
+var limitDescription = [4]string{
+	"operator nesting depth",
+	"input size",
+	"number of included files",
+	"number of symbols",
 }
 
 var specialDescription = [5]string{
@@ -46,6 +86,7 @@ var specialDescription = [5]string{
 func NewConfig() *Config {
 	return &Config{
 		specList: [5]rune{'$', '[', ']', '=', '\\'},
+		modifier: ':',
 		opDict: map[string]opConstant{
 			"macro":   OpMacro,
 			"cond":    OpCond,
@@ -54,7 +95,14 @@ func NewConfig() *Config {
 			"include": OpInclude,
 			"reset":   OpReset,
 			"--":      OpSkip,
+			"switch":  OpSwitch,
+			"foreach": OpForeach,
+			"export":  OpExport,
+			"clear":   OpClear,
 		},
+		disabled:  make(map[opConstant]bool),
+		limits:    [4]int{100, 16 << 20, 1000, 10000},
+		functions: builtinFunctions(),
 	}
 }
 
@@ -67,7 +115,53 @@ func (c *Config) copy() *Config {
 	for n, v := range c.opDict {
 		oc[n] = v
 	}
-	return &Config{specList: sc, opDict: oc}
+	dc := make(map[opConstant]bool, len(c.disabled))
+	for o, v := range c.disabled {
+		dc[o] = v
+	}
+	var rc []string
+	if c.incRoots != nil {
+		rc = append([]string{}, c.incRoots...)
+	}
+	var ec map[string]bool
+	if c.envNames != nil {
+		ec = make(map[string]bool, len(c.envNames))
+		for n, v := range c.envNames {
+			ec[n] = v
+		}
+	}
+	fc := make(map[string]Function, len(c.functions))
+	for n, f := range c.functions {
+		fc[n] = f
+	}
+	return &Config{
+		specList:  sc,
+		modifier:  c.modifier,
+		opDict:    oc,
+		opCustom:  append([]customOp(nil), c.opCustom...),
+		disabled:  dc,
+		incRoots:  rc,
+		envNames:  ec,
+		limits:    c.limits,
+		functions: fc,
+	}
+}
+
+// operators returns all enabled operators in documentation sequence: built-in
+// operators first, then operators added by the program.
+func (c *Config) operators() []opConstant {
+	ops := make([]opConstant, 0, len(builtinOps)+len(c.opCustom))
+	for _, op := range builtinOps {
+		if !c.disabled[op] {
+			ops = append(ops, op)
+		}
+	}
+	for i := range c.opCustom {
+		if op := opCustom + opConstant(i); !c.disabled[op] {
+			ops = append(ops, op)
+		}
+	}
+	return ops
 }
 
 // GetSpecial returns the character currently corresponding to a special
@@ -81,7 +175,9 @@ func (c *Config) GetSpecial(which specConstant) rune {
 }
 
 // SetSpecial changes a special character identified by a constant. Panics if
-// ch is invalid, or is already used, or if spec is unknown.
+// ch is invalid, or is already used, or if spec is unknown. When ch is the
+// modifier separator, modifiers cannot be used in symbol references until
+// another separator is set with SetModifier.
 func (c *Config) SetSpecial(spec specConstant, ch rune) {
 	switch spec {
 	case SpecSymbolPrefix:
@@ -102,6 +198,26 @@ func (c *Config) SetSpecial(spec specConstant, ch rune) {
 
 }
 
+// GetModifier returns the character separating a symbol from a modifier in a
+// symbol reference, by default ':'.
+func (c *Config) GetModifier() rune {
+	return c.modifier
+}
+
+// SetModifier changes the character separating a symbol from a modifier in a
+// symbol reference. Panics if ch is invalid or is a special character.
+func (c *Config) SetModifier(ch rune) {
+	if !validSpecial(ch) {
+		panic(fmt.Errorf("cannot use '%c' as modifier separator: not a valid special character", ch))
+	}
+	for _, r := range c.specList {
+		if ch == r {
+			panic(fmt.Errorf("cannot use '%c' as modifier separator: already used", ch))
+		}
+	}
+	c.modifier = ch
+}
+
 func (c *Config) isDuplicate(i specConstant, ch rune) bool {
 	switch i {
 	case 0:
@@ -118,6 +234,41 @@ func (c *Config) isDuplicate(i specConstant, ch rune) bool {
 	panic(fmt.Errorf("bug found: %d", i))
 }
 
+// GetLimit returns the current value of a limit identified by its constant.
+// Zero means no limit.
+func (c *Config) GetLimit(which limitConstant) int {
+	switch which {
+	case LimitDepth, LimitInput, LimitIncludes, LimitSymbols:
+		return c.limits[which]
+	}
+	panic(fmt.Errorf(`unknown limit: %v`, which))
+}
+
+// SetLimit changes a limit identified by a constant. The limits protect the
+// program against input which would otherwise exhaust its resources:
+//
+//	LimitDepth     operators nested in operators (default 100)
+//	LimitInput     bytes of input parsed, counting the content of included
+//	               files and the expansions of macros and other operators, and
+//	               bytes of any value after symbol substitution (default 16 MiB)
+//	LimitIncludes  files included (default 1000)
+//	LimitSymbols   symbols in the symbol table (default 10000)
+//
+// Limits on input size and included files apply to each call to
+// Parser.Parse and related methods. Zero means no limit. Panics if n is
+// negative or if which is unknown.
+func (c *Config) SetLimit(which limitConstant, n int) {
+	switch which {
+	case LimitDepth, LimitInput, LimitIncludes, LimitSymbols:
+	default:
+		panic(fmt.Errorf(`unknown limit: %v`, which))
+	}
+	if n < 0 {
+		panic(fmt.Errorf("cannot set %s limit to %d: negative", limitDescription[which], n))
+	}
+	c.limits[which] = n
+}
+
 // GetOpName returns the name of operator op. Panics if op is unknown.
 func (c *Config) GetOpName(op opConstant) string {
 	for n, o := range c.opDict {
@@ -150,3 +301,73 @@ func (c *Config) SetOpName(op opConstant, name string) {
 		panic(fmt.Errorf(`cannot set name of %v to "%s": no such operator`, op, name))
 	}
 }
+
+// AddOperator adds an operator with a name, a factory and a line of
+// documentation, printed by Parser.PrintConfig. It returns the constant
+// identifying the new operator, which can be used with other Config methods.
+// When the parser finds the operator name in the input, it calls the factory
+// with itself as argument and passes the value to the Handle method of the
+// operator returned. An operator can define its own subparameters using a
+// parser obtained with SubParser, and can feed input to the parser with
+// Parser.ParseFragment. Panics if name is invalid or is already used, or if
+// there are too many operators.
+func (c *Config) AddOperator(name string, factory func(parser *Parser) Operator, doc string) opConstant {
+	if err := validate(name); err != nil {
+		panic(err)
+	}
+	if _, ok := c.opDict[name]; ok {
+		panic(fmt.Errorf(`cannot add operator "%s": name already used`, name))
+	}
+	if len(c.opCustom) > int(^opConstant(0)-opCustom) {
+		panic(fmt.Errorf(`cannot add operator "%s": too many operators`, name))
+	}
+	op := opCustom + opConstant(len(c.opCustom))
+	c.opCustom = append(c.opCustom, customOp{factory: factory, doc: doc})
+	c.opDict[name] = op
+	return op
+}
+
+// AddFunction adds a function for use in symbol references. Panics if the name
+// is invalid or already used.
+func (c *Config) AddFunction(name string, f Function) {
+	if err := validate(name); err != nil {
+		panic(err)
+	}
+	if _, ok := c.functions[name]; ok {
+		panic(fmt.Errorf(`cannot add function "%s": name already used`, name))
+	}
+	c.functions[name] = f
+}
+
+// DisableOp disables an operator identified by a constant. Using a disabled
+// operator in the input results in an error. The name of the operator remains
+// reserved and cannot be used for a parameter. Panics if op is unknown.
+func (c *Config) DisableOp(op opConstant) {
+	c.GetOpName(op) // panics if unknown
+	c.disabled[op] = true
+}
+
+// RestrictInclude restricts the include operator to files located in one of
+// the directories specified or in their subdirectories. Relative directories
+// are resolved against the working directory when files are included. When
+// file systems are configured with Parser.SetFS, the directories are file
+// system paths. Calling RestrictInclude again adds directories. Without any
+// call, files can be included from anywhere.
+func (c *Config) RestrictInclude(dir ...string) {
+	c.incRoots = append(c.incRoots, dir...)
+	if c.incRoots == nil {
+		c.incRoots = []string{}
+	}
+}
+
+// RestrictImport restricts the import operator to the environment variables
+// named. Calling RestrictImport again adds names. Without any call, all
+// environment variables can be imported.
+func (c *Config) RestrictImport(name ...string) {
+	if c.envNames == nil {
+		c.envNames = make(map[string]bool, len(name))
+	}
+	for _, n := range name {
+		c.envNames[n] = true
+	}
+}
@@ -1,7 +1,12 @@
 package args_test
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/jpvetterli/args"
@@ -129,3 +134,209 @@ func TestConfigPanic5(t *testing.T) {
 	c := args.NewConfig()
 	c.SetSpecial(args.SpecEscape, '$')
 }
+
+func TestConfigPanic6(t *testing.T) {
+	defer panicHandler(`cannot add operator "include": name already used`, t)
+	c := args.NewConfig()
+	c.AddOperator("include", nil, "")
+}
+
+func TestConfigAddOperator(t *testing.T) {
+	c := args.NewConfig()
+	var values []string
+	op := c.AddOperator("collect", func(p *args.Parser) args.Operator {
+		return operatorFunc(func(value string) error {
+			values = append(values, value)
+			return nil
+		})
+	}, "collect values")
+	c.SetOpName(op, "sammeln")
+	a := args.CustomParser(c)
+	if err := a.Parse("$X=x sammeln=[a $[X]] sammeln=b"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(values) != "[a x b]" {
+		t.Errorf("unexpected values: %v", values)
+	}
+	defer panicHandler(`parameter name "sammeln" is the name of an operator`, t)
+	a.Def("sammeln", &values)
+}
+
+type operatorFunc func(value string) error
+
+func (f operatorFunc) Handle(value string) error {
+	return f(value)
+}
+
+func TestConfigDisableOp(t *testing.T) {
+	c := args.NewConfig()
+	c.DisableOp(args.OpInclude)
+	c.SetOpName(args.OpImport, "importieren")
+	c.DisableOp(args.OpImport)
+	a := args.CustomParser(c)
+	foo := ""
+	a.Def("foo", &foo)
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/include.test]"),
+		`operator "include" is disabled`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("importieren=[$HOME]"),
+		`operator "importieren" is disabled`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	var buf bytes.Buffer
+	a.PrintConfig(&buf)
+	if strings.Contains(buf.String(), "include") || strings.Contains(buf.String(), "importieren") {
+		t.Errorf("disabled operators printed: %s", buf.String())
+	}
+}
+
+func TestConfigRestrictInclude(t *testing.T) {
+	c := args.NewConfig()
+	c.RestrictInclude("testdata/sub")
+	a := args.CustomParser(c)
+	foo := ""
+	bar := ""
+	a.Def("foo", &foo)
+	a.Def("bar", &bar)
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/sub/relative.test]"),
+		`include: "testdata/include.test": not in a permitted directory`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/sub/../include.test optional]"),
+		`include: "testdata/sub/../include.test": not in a permitted directory`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	c.RestrictInclude("testdata")
+	a = args.CustomParser(c)
+	a.Def("foo", &foo)
+	a.Def("bar", &bar)
+	if err := a.Parse("include=[testdata/sub/relative.test]"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigRestrictIncludeSymlink(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	out := filepath.Join(dir, "out")
+	for _, d := range []string{in, out} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(in, "file.test"), []byte("foo=inside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(out, "file.test"), []byte("foo=outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(in, "file.test"), filepath.Join(in, "link.test")); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink(filepath.Join(out, "file.test"), filepath.Join(in, "escape.test")); err != nil {
+		t.Fatal(err)
+	}
+	c := args.NewConfig()
+	c.RestrictInclude(in)
+	a := args.CustomParser(c)
+	foo := ""
+	a.Def("foo", &foo)
+	if err := matchResult(
+		a.Parse("include=["+filepath.Join(in, "link.test")+"]"),
+		func() error {
+			if foo != "inside" {
+				return fmt.Errorf(`unexpected result: foo="%s"`, foo)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+	escape := filepath.Join(in, "escape.test")
+	if err := matchErrorMessage(
+		a.Parse("include=["+escape+"]"),
+		`include: "`+escape+`": not in a permitted directory`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestConfigRestrictImport(t *testing.T) {
+	os.Setenv("TESTENV", "value of TESTENV")
+	c := args.NewConfig()
+	c.RestrictImport("TESTENV", "HOME")
+	a := args.CustomParser(c)
+	foo := ""
+	a.Def("foo", &foo)
+	if err := matchResult(
+		a.Parse("import=[$TESTENV] foo=$[TESTENV]"),
+		func() error {
+			if foo != "value of TESTENV" {
+				return fmt.Errorf(`unexpected result: foo="%s"`, foo)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("import=[$TESTENV $SECRET]"),
+		`import: "$SECRET": environment variable not permitted`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestConfigPanic7(t *testing.T) {
+	defer panicHandler(`cannot set operator nesting depth limit to -1: negative`, t)
+	c := args.NewConfig()
+	c.SetLimit(args.LimitDepth, -1)
+}
+
+func TestConfigAddFunction(t *testing.T) {
+	c := args.NewConfig()
+	c.AddFunction("repeat", func(value string, a ...string) (string, error) {
+		if len(a) != 1 {
+			return "", fmt.Errorf("repeat: count missing")
+		}
+		n, err := strconv.Atoi(a[0])
+		if err != nil {
+			return "", err
+		}
+		return strings.Repeat(value, n), nil
+	})
+	a := args.CustomParser(c)
+	foo := ""
+	a.Def("foo", &foo)
+	if err := a.Parse("$x=ab foo=$[repeat x 3]"); err != nil {
+		t.Error(err)
+	}
+	if foo != "ababab" {
+		t.Errorf("unexpected result: %s", foo)
+	}
+}
+
+func TestConfigPanic8(t *testing.T) {
+	defer panicHandler(`cannot add function "upper": name already used`, t)
+	c := args.NewConfig()
+	c.AddFunction("upper", nil)
+}
+
+func TestConfigPanic9(t *testing.T) {
+	defer panicHandler(`cannot use '=' as modifier separator: already used`, t)
+	c := args.NewConfig()
+	c.SetModifier('=')
+}
+
+func TestConfigPanic10(t *testing.T) {
+	defer panicHandler(`cannot use 'x' as modifier separator: not a valid special character`, t)
+	c := args.NewConfig()
+	c.SetModifier('x')
+}
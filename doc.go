@@ -129,6 +129,10 @@ omitted. Parameters with an empty name are known as anonymous and their values
 as standalone values. When a standalone value is the name of a parameter, it
 is interpreted as that name with the value "true". This effect is usually what
 is wanted, but if necessary, can be avoided by using a quoted empty string: [].
+A parameter defined with Param.Counter counts its standalone occurrences, so
+that "v v v" sets v to 3. A parameter defined with Param.Negatable also has the
+name "no-" followed by its name, which sets the inverted value: "no-color"
+sets color to false.
 
 White space around separators is ignored but is significant between words, as it
 separates distinct values. It can be included in values by quoting. When a
@@ -177,6 +181,54 @@ $x=bar", the value of "foo" cannot be resolved. Redefining a symbol has no
 effect:  the first wins (unlike parameters, where the last wins). The
 specification "$x=bar $x=quux foo=$[x]" is equivalent to "foo=bar".
 
+A reference can include a modifier, written after the symbol and a colon, and
+followed by a text, which can contain references and nested quotes:
+
+  $[x:-text]  substitutes the value of x, or the text if x is undefined
+  $[x:?text]  substitutes the value of x, and is an error if x is undefined,
+              with the text as error message
+  $[x:+text]  substitutes the text if x is defined, else nothing
+
+The text is used as if it were between quotes. Modifiers for undefined symbols
+do not take effect in values of symbols, operators, and verbatim parameters.
+The reference is kept unresolved and the modifier takes effect when the value
+is used. In "$m=[foo=$[port:-80]] macro=[$m port=8080]", for example, foo has
+the value "8080". In "foo=$[x:?please specify x]", the error message includes
+"please specify x" if the symbol x is not defined. The colon separating the
+symbol from the modifier can be changed with Config.SetModifier, which is
+needed when the colon is configured as a special character.
+
+A reference can also be a function call, with a function name followed by a
+symbol and optional arguments, separated by white space, as in "$[upper HOME]"
+or "$[replace PATH : [, ]]". The function is applied to the value of the
+symbol. Arguments are split like any input and can contain references. When
+the symbol is undefined, the reference is left unresolved, as usual. These
+functions are built into args:
+
+  upper x            x in upper case
+  lower x            x in lower case
+  trim x [cutset]    x without leading and trailing white space, or characters
+                     in cutset
+  replace x old new  x with all occurrences of old replaced with new
+  basename x         last element of path x
+  dirname x          x without its last element
+  join x elem...     x and elements joined into a path
+
+Programs can add their own functions with Config.AddFunction.
+
+Programs can define symbols before parsing with Parser.SetSymbol, instead of
+adding definitions to the input, and can examine symbols after parsing with
+Parser.Symbol and Parser.Symbols. Parser.DeleteSymbol removes a symbol.
+
+By default, all symbols are global. When a program calls
+Parser.SetScopedSymbols, symbols defined while parsing an included file, a
+macro, the input selected by cond or switch, or the input of one iteration of
+foreach are local: they are discarded at the end of the input, unless they are
+made global with the export operator. A reference is resolved in the innermost
+scope first, and then in enclosing scopes. The first wins principle applies to
+all visible symbols. Local symbols let a file use auxiliary symbols without
+affecting the files which include it.
+
 Omission And Repetition
 
 When a parameter is defined, it gets a target, which is the program variable
@@ -200,15 +252,115 @@ with a splitter, which is a regular expression. For example, if a splitter
 is defined to split a string around a colon (with optional white space)
 the specification "foo=[1:2:3] foo=[ 4 : 5]" sets 5 values.
 
+Values of a parameter with a slice or map target are added to the values
+already specified. When a parameter is defined with Param.Replace, each
+specification replaces all values previously set, including default values.
+The clear operator removes all values explicitly (see below).
+
+Environment Variables
+
+A parameter can be bound to an environment variable with Param.Env, or all
+named parameters can be bound at once with Parser.SetEnvPrefix. When the input
+does not set a parameter, it takes its value from the environment variable if
+it exists. A value specified in the input always wins over the environment
+variable, and the environment variable wins over the default value. For
+example, if the parameter "port" is bound to TOOL_PORT and TOOL_PORT is 8080,
+parsing "port=80" sets port to 80, and parsing an empty input sets it to 8080.
+PrintDoc shows the name of the variable.
+
+Layered Sources
+
+A program combining several sources of input, like built-in defaults, a
+system file, a user file, environment variables and the command line, adds
+them with Parser.AddSource in increasing order of precedence, and parses them
+with Parser.ParseSources. Sources are created with FileSource, FSSource,
+EnvSource, ArgsSource and StringSource. A file source made optional with
+Source.Optional is skipped if the file does not exist. For example:
+
+  a.AddSource(
+    args.FSSource(defaults, "tool.args"),
+    args.FileSource("/etc/tool.args").Optional(),
+    args.EnvSource(),
+    args.ArgsSource(os.Args[1:]),
+  )
+  err := a.ParseSources()
+
+A parameter taking a single value takes the value of the last source setting
+it. A parameter with a slice target accumulates the values of all sources,
+unless it is defined with Param.LayerReplace, in which case the last source
+setting it replaces the values of earlier sources. Symbols keep the "first
+wins" principle across sources.
+
+Secrets
+
+A parameter defined with Param.Secret holds a value which must not be
+disclosed, like a password. Its value is shown as *** by dump, PrintDoc and the
+parser trace, and is replaced with *** in error messages. The values of secret
+symbols are also replaced with *** in error messages, including errors of
+operators and of names, and in the parser trace. When the input causing an
+error includes the value of a secret symbol, the words of the value are
+replaced too, because the value may have been split. Symbols become secret
+when imported or included with the standalone value "secret" (see import and
+include). A secret symbol remains secret when it is referenced: a symbol or a
+parameter taking a value which includes the value of a secret symbol becomes
+secret itself.
+
+Callbacks
+
+A function set with Param.OnSet is called each time the parameter is set,
+after the value has been assigned to the target. It can trigger an immediate
+action, like printing help, or define additional parameters, which can be
+specified in the remaining input. For a single entry set in a map, by a key of
+the anonymous map or of an INI section, the function takes the key and the
+value joined by the separator, like "key=value". An error returned by the
+function is reported like a conversion error. Functions added with Parser.AfterParse are called when
+parsing has completed and all parameters have been verified, for example to
+check dependencies between parameters.
+
+Parameters can also be defined while parsing, depending on earlier input. With
+Param.When, a program sets a function defining a group of parameters when a
+parameter takes a given value. For example, with:
+
+  a.Def("driver", &driver).When("postgres", func(a *args.Parser) {
+    a.Def("host", &host)
+  })
+
+the input "driver=postgres host=db" sets host, but "host=db driver=postgres" is
+an error, because host is not defined before driver takes the value postgres.
+The function is called once, before any OnSet function, and parameters it
+defines are verified like all other parameters when parsing completes, unless
+the last value of the parameter no longer selects the group. For example,
+"driver=postgres driver=sqlite" does not require host, following the "last
+wins" principle, also when the first value is taken from a source of defaults. A
+definition error in the function is reported as a parse error instead of
+causing a panic. PrintDoc documents groups not yet defined after all other
+parameters, under a line like "parameters when driver=postgres:".
+
 Operators
 
-There are 7 operators built into args. Operators are built-in commands which
+There are 11 operators built into args. Operators are built-in commands which
 have an effect on the state of the parser. From a user perspective, they look
 like any other parameter, with a name, a name-value separator, and a value
 containing subparameters. In increasing order of sophistication, they are --
-(pronounced "comment"),  dump, reset, import, macro, cond, and include. Operator
-subparameters are all defined as verbatim  (see Param.Verbatim) except for two
-subparameters of include.
+(pronounced "comment"),  dump, reset, clear, import, export, macro, foreach,
+cond, switch, and include. Operator subparameters are all defined as verbatim
+(see Param.Verbatim) except for two subparameters of include.
+
+Programs can add their own operators with Config.AddOperator. They look and
+behave like built-in operators and are listed with them by Parser.PrintConfig.
+
+When the input comes from untrusted sources, programs can disable operators
+with Config.DisableOp, restrict include to some directories with
+Config.RestrictInclude, and restrict import to some environment variables with
+Config.RestrictImport. Using a disabled operator, including a file outside the
+permitted directories or importing a variable not permitted is an error.
+
+Operators like macro and include can be nested, and symbol substitution can
+produce large values. To protect programs against input which would exhaust
+their resources, the parser limits the nesting depth of operators, the size of
+the input including expansions, the number of included files, and the number
+of symbols. Exceeding a limit is an error. Programs can change the limits with
+Config.SetLimit.
 
 The comment operator
 
@@ -248,6 +400,25 @@ and produce the output:
   $PATH R locked
   ? $XYZZY
 
+Programs can send the output to another writer with Parser.SetDumpWriter. The
+standalone "all" parameter prints all parameters, in definition sequence, and
+all symbols, in alphabetical order, without listing them. Synonyms are not
+printed, and names listed explicitly are printed first. With format=json,
+dump prints a JSON object per line, with the members name, kind (comment,
+parameter, or symbol), value, resolved, and defined. The value of a parameter
+with an array or slice target is an array. For example, "dump=[format=json
+slic $XYZZY]" prints:
+
+  {"name":"slic","kind":"parameter","value":["1","0.5","42"],"resolved":true,"defined":true}
+  {"name":"$XYZZY","kind":"symbol","value":null,"resolved":false,"defined":false}
+
+Programs using the log/slog package can pass a logger to Parser.SetLogger.
+dump then logs its records, unless a writer has been set. With
+Parser.SetTrace, the parser also logs, at the debug level, each operator
+invocation and events like the branch taken by cond or switch, files included,
+macros expanded, environment variables imported, and symbols reset. This helps
+to understand a complex specification without adding dump operators.
+
 The reset operator
 
 The reset operator is used to remove symbols. It takes a series of values,
@@ -265,6 +436,22 @@ produces:
   $SYM1 U 1
   $SYM2 U b
 
+The clear operator
+
+The clear operator removes all values of parameters with a slice or a map
+target, including default values. It takes a series of parameter names. It is
+useful when values specified in a file, typically included, must be replaced
+instead of being added to. For example, if paths is a parameter with a slice
+target, the specification:
+
+  paths=/usr paths=/opt clear=paths paths=/bin
+
+sets paths to [/bin]. An error occurs if a parameter is not defined or if its
+target is neither a slice nor a map. A parameter defined with Param.Replace
+behaves as if it were cleared before each specification. The anonymous
+parameter cannot be defined with Param.Replace, because each standalone value
+is a separate specification.
+
 The import operator
 
 The import operator is used to import environment variables. It takes a series
@@ -282,6 +469,28 @@ produces the output:
   ? $NONESUCH
   [/home/user42]
 
+When the standalone value "secret" is specified, the imported symbols are
+secret, as in import=[$DB_PASSWORD secret].
+
+A program can also bind parameters directly to environment variables, without
+import (see "Environment Variables" above).
+
+The export operator
+
+The export operator makes local symbols global. It takes a series of values,
+which it interprets as symbols, and copies them to the global symbol table,
+unless they are already there. Values are copied resolved when possible. An
+error occurs if values are not symbols or if any symbol is undefined. For
+example, with scoped symbols, a file containing
+
+  $tmp=/var/tmp
+  $cache=[$[tmp]/cache]
+  export=[$cache]
+
+defines the global symbol $cache with the value "/var/tmp/cache", and $tmp is
+discarded at the end of the file. Export can also be used to keep the value of
+a macro argument or of a foreach symbol.
+
 The macro operator
 
 The macro operator is used to expand standalone symbol references. Without
@@ -305,31 +514,148 @@ the string slice foo has the values "number 1" and "number 2". Notice the reset
 operator, necessary for the new count to take effect (because of the "first
 wins" principle).
 
+Macros can take arguments, specified as name-value pairs. Arguments are bound
+as local symbols, which are visible only while the macro is expanded. The
+previous example can be written without reset:
+
+  $macro=[foo=[number $[count]]]
+  macro=[$macro count=1]
+  macro=[$macro count=2]
+
+Remember that references in the value of a symbol are substituted when the
+symbol is defined, if the referenced symbols are defined at that time. An
+argument has therefore no effect on references to a symbol which was already
+defined when the macro was defined. With the input
+
+  $count=0 $macro=[foo=[number $[count]]]
+  macro=[$macro count=1]
+
+foo has the value "number 0". This is deliberate: a macro is an ordinary
+symbol, and its value is fixed like the value of any other symbol, so that an
+argument cannot change a reference which the author of the macro has already
+bound to a global symbol. Arguments are meant for references to symbols which
+are not defined when the macro is defined. Otherwise arguments take precedence over symbols
+with the same name defined after the macro, and the values of such symbols
+which depend on arguments are resolved for each expansion. Symbols defined
+during an expansion are not local.
+
+The foreach operator
+
+The foreach operator parses an input repeatedly, once for each value in a list.
+The "var" parameter specifies a symbol, the "in" parameter, which can be
+repeated, specifies the values, and the "do" parameter specifies the input. The
+values of "in" are split like any input, unless a regular expression is
+specified with the optional "split" parameter. For each value, the symbol is
+bound to the value as a local symbol, like a macro argument, and the input is
+parsed. For example, after parsing the input
+
+  foreach=[var=$host in=[a b c] do=[backend=[$[host]:80]]]
+
+the string slice backend has the values "a:80", "b:80", and "c:80". With
+split=[\s*,\s*], the list could be specified as in=[a, b, c]. Like in cond,
+symbol references in the value of foreach are not substituted beforehand:
+references in "in" are substituted when the list is split, and references in
+"do" for each value, with the symbol bound. The symbol hides any symbol with
+the same name while "do" is parsed.
+
 The cond operator
 
 The cond operator allows conditional parsing. It has two mandatory parameters,
-"if" and "then" and an optional one, "else", all taking one value.  The value of
-"if" is interpreted as a parameter name or symbol. It  evaluates to true if the
-symbol exists or if the parameter has been set at least once. If the value is an
-undefined parameter, an error occurs. When the value of "if" is true the value
-of "then" is parsed, else it is the value of "else" which is parsed, if
-specified. For example, after parsing the input
+"if" and "then", an optional parameter "elif", which can be repeated, and an
+optional parameter "else". The values of "if" and "elif" are conditions, which
+are evaluated in sequence until one is true. The value of the corresponding
+"then" is then parsed: the first "then" goes with "if", the second one with the
+first "elif", and so on. When no condition is true, the value of "else" is
+parsed, if specified. For example, after parsing the input
 
   cond=[if=[$UNDEF] then=[foo=foo] else=[foo=bar]]
 
 the string foo has the value "bar".
 
+A condition is an expression made of operands, comparisons, the boolean
+operators "and", "or" and "not", and parentheses. "not" has the highest
+precedence and "or" the lowest. An operand is a symbol, written $name or
+$[name], a number, one of the words true and false, a parameter name, or a
+value between quotes. Any other word is a parameter name: a value must be
+quoted, as in $ENV == [dev], even if there is no parameter with this name, and
+an error occurs if the parameter is not defined. Alone, a symbol is true if it
+is defined, a parameter is true if it has been set at least once, and a value
+is true if it is a true boolean value or, when it is not a boolean value, if it
+is not empty. Operands of "and" and "or" are evaluated from left to right, and
+only until the result is known. In a comparison, the value of a symbol is its
+resolved value and the value of a parameter is its current value. The
+comparison operators are == and != for equality and inequality of strings, =~
+for matching a regular expression, and <, <=, >, and >= for comparing numbers. A comparison with an undefined symbol is false,
+except when it is an inequality and the other operand is defined. Symbol
+references in the value of cond are not substituted before the conditions are
+evaluated, so that the value of a symbol is always a single operand, even if
+it contains white space or operators. For example, with the input
+
+  $ENV=prod
+  cond=[
+    if=[$ENV == [dev] or $ENV == [test]] then=[level=3]
+    elif=[$ENV =~ [^prod] and not verbose] then=[level=1]
+    else=[level=2]
+  ]
+
+level has the value 1, unless verbose has been set.
+
+The switch operator
+
+The switch operator selects one of several inputs to parse, depending on the
+value of a subject. The subject is specified as anonymous parameter and is a
+symbol or a parameter name. The operator has a "case" parameter, which can be
+repeated, and an optional "default" parameter. Each case consists of a value
+and a block between quotes. The block of the first case with a value equal to
+the value of the subject is parsed. When no case matches, the value of
+"default" is parsed, if specified. An undefined symbol matches no case and an
+undefined parameter is an error. Like in cond, symbol references in the value
+of switch are not substituted beforehand: references in the value of a case are
+substituted when it is compared, and references in a block when it is parsed.
+For example, after parsing the input
+
+  $ENV=staging
+  switch=[$ENV
+    case=[dev [level=3]]
+    case=[staging [level=2]]
+    case=[prod [level=1]]
+    default=[level=0]
+  ]
+
+level has the value 2.
+
 The include operator
 
-The include operator has two different modes: a basic mode for recursively
-parsing a file containing parameters and a key-selection mode for extracting
-name-value pairs from a file.
+The include operator has three different modes: a basic mode for recursively
+parsing a file containing parameters, a key-selection mode for extracting
+name-value pairs from a file, and an INI mode for extracting name-value pairs
+from a file with sections.
 
 In basic mode, include takes a file name as anonymous parameter. It reads the
 file and parses its content recursively.  Files can be included recursively and
 any cyclical dependency is detected. The anonymous parameter taking the file
 name is one the two operator parameters not defined as verbatim.
 
+Files are read from the file system of the operating system, unless the program
+has configured other file systems with Parser.SetFS, for example to provide
+default parameter files embedded in the program. File names must then be valid
+io/fs path names, which use slashes and are not rooted.
+
+A relative file name in an included file is resolved against the directory of
+the included file, so that a file can include a file next to it independently
+of the working directory. If the file does not exist, it is searched in the
+directories of the include path configured by the program (see
+Parser.AddIncludePath). Resolution against the working directory can be
+restored with Parser.SetRelativeIncludes.
+
+A file which may not exist is included with the standalone value "optional",
+as in include=[/etc/tool/$[HOST].args optional]. The file is silently skipped
+when it does not exist. A file name containing any of the characters *, ? or [
+is a pattern (see path.Match). All matching files are included in lexical
+order, as in include=[conf.d/*.args], and cycles are detected for each of them.
+A pattern matching no file is an error, unless "optional" is specified. Notice
+that [ must be escaped when it is the open quote.
+
 In key-selection mode, include takes a file name, a "keys" parameter, and an
 optional "extractor" parameter. (The extractor parameter is the second operator
 parameter which is not verbatim.) The value of "keys" is interpreted as a series
@@ -344,6 +670,14 @@ The "extractor" parameter specifies a custom regular expression for extracting
 key-value pairs. The default extractor is \s*(\S+)\s*=\s*(\S+)\s*. It is an
 error to specify an extractor in basic mode (when no keys are specified).
 
+An extractor must have exactly two capture groups, for the key and the value,
+unless it uses groups named "key" and "value", as in (?P<key>\w+)=(?P<value>\S+),
+in which case it can have any number of other groups. Only the first match in
+each line is used, unless the standalone value "all" is specified, which uses
+all matches in each line, or the standalone value "whole" is specified, which
+uses all matches in the whole file. With "whole", a value can span multiple
+lines, as with the extractor (?s)(?P<key>\w+)="(?P<value>.*?)".
+
 As an example, suppose there is file /home/u649/.db.conf with data we can use.
 Only the user and password information is needed.
 
@@ -369,7 +703,38 @@ produces this dump output:
   $PASS U !=.sesam568
 
 This example will parse successfully only if the user running
-the program has read access to the file.
+the program has read access to the file. With the standalone value "secret",
+all symbols and parameters set by include are secret, and the dump output
+becomes:
+
+  usr ***
+  $PASS U ***
+
+INI mode is selected with the standalone value "ini". It works like
+key-selection mode, but the file is read as an INI file, where [section] lines
+start sections, keys and values are separated by = or :, and lines starting
+with ; or # are comments. Keys are addressed as section.key, so identical keys
+in different sections do not collide. Keys preceding the first section are
+addressed without a section. The optional "sections" parameter takes a series
+of section names or section-translation pairs, where the translation is the
+name of a parameter with a map target. All name-value pairs of the section are
+put into the map. An extractor cannot be specified in INI mode.
+
+As an example, suppose there is a file /etc/tool.ini:
+
+  [db]
+  user = u650
+  password = !=.sesam569
+  [cache]
+  user = u651
+  ttl = 60
+
+If cache is a parameter with a map target, parsing the input
+
+  include=[/etc/tool.ini ini keys=[db.user=usr db.password=$PASS] sections=[cache]]
+
+sets usr to "u650", the symbol $PASS to "!=.sesam569", and puts the keys
+"user" and "ttl" into the cache map.
 
 */
 package args
@@ -68,13 +68,17 @@ func ExampleParser_PrintDoc() {
 	//   \        escape
 	//
 	// Built-in operators:
-	//   cond     conditional parsing (if, then, else)
-	//   dump     print parameters and symbols on standard error (comment)
+	//   clear    remove all values of slice and map parameters
+	//   cond     conditional parsing (if, then, elif, else)
+	//   dump     print parameters and symbols (comment, format, all)
+	//   export   make local symbols global
+	//   foreach  repeat parsing for a list of values (var, in, split, do)
 	//   import   import environment variables as symbols
-	//   include  include a file or extract name-values (keys, extractor)
+	//   include  include a file or extract name-values (optional, keys, extractor, all, whole, ini, sections, secret)
 	//   macro    expand symbols
 	//   reset    remove symbols
 	//   --       do not parse the value (= comment out)
+	//   switch   multi-way branching (case, default)
 }
 
 func ExampleParam_Scan() {
@@ -153,3 +157,68 @@ func ExampleParam_Verbatim() {
 	// x y
 	// a b
 }
+
+// profileOperator is an operator which selects a set of parameter values by
+// name.
+type profileOperator struct {
+	parser *args.Parser
+}
+
+func (o *profileOperator) Handle(value string) error {
+	local := args.SubParser(o.parser)
+	name := ""
+	verbose := false
+	local.Def("", &name)
+	local.Def("verbose", &verbose).Opt()
+	if err := local.Parse(value); err != nil {
+		return err
+	}
+	switch name {
+	case "dev":
+		return o.parser.ParseFragment("host=localhost port=8080")
+	case "prod":
+		return o.parser.ParseFragment("host=example.com port=80")
+	}
+	return fmt.Errorf(`profile: "%s" unknown`, name)
+}
+
+func ExampleConfig_AddOperator() {
+	c := args.NewConfig()
+	c.AddOperator("profile", func(p *args.Parser) args.Operator {
+		return &profileOperator{parser: p}
+	}, "select a profile (verbose)")
+	a := args.CustomParser(c)
+	host := ""
+	port := 0
+	a.Def("host", &host)
+	a.Def("port", &port)
+	if err := a.Parse("profile=prod port=8443"); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(host, port)
+	a.PrintConfig(os.Stdout)
+
+	// output:
+	// example.com 8443
+	//
+	// Special characters:
+	//   $        symbol prefix
+	//   [        open quote
+	//   ]        close quote
+	//   =        separator
+	//   \        escape
+	//
+	// Built-in operators:
+	//   clear    remove all values of slice and map parameters
+	//   cond     conditional parsing (if, then, elif, else)
+	//   dump     print parameters and symbols (comment, format, all)
+	//   export   make local symbols global
+	//   foreach  repeat parsing for a list of values (var, in, split, do)
+	//   import   import environment variables as symbols
+	//   include  include a file or extract name-values (optional, keys, extractor, all, whole, ini, sections, secret)
+	//   macro    expand symbols
+	//   reset    remove symbols
+	//   --       do not parse the value (= comment out)
+	//   switch   multi-way branching (case, default)
+	//   profile  select a profile (verbose)
+}
@@ -0,0 +1,366 @@
+package args
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// exprKind identifies the kind of an expression token.
+type exprKind uint8
+
+const (
+	exprEnd     exprKind = iota
+	exprOpen             // (
+	exprClose            // )
+	exprCompare          // ==, !=, =~, <, <=, >, >=
+	exprAnd              // and
+	exprOr               // or
+	exprNot              // not
+	exprSymbol           // $name or $[name]
+	exprQuoted           // text between quotes
+	exprWord             // parameter name, number, true or false
+)
+
+// exprToken is a token of a condition expression.
+type exprToken struct {
+	kind exprKind
+	s    string
+}
+
+// operand is the value of an operand in a condition expression.
+type operand struct {
+	s       string // value
+	defined bool   // false for undefined symbols
+	truth   func() (bool, error)
+}
+
+// condExpr evaluates condition expressions of the cond operator. The syntax is
+// explained in the package documentation.
+type condExpr struct {
+	parser *Parser
+	name   string // operator and subparameter, for error messages
+	tokens []exprToken
+	pos    int
+	skip   int // greater than zero while parsing without evaluating
+}
+
+// evaluate returns the value of a condition expression. The name identifies
+// the expression in error messages.
+func (a *Parser) evaluate(name, s string) (bool, error) {
+	tokens, err := a.lexExpr(name, s)
+	if err != nil {
+		return false, err
+	}
+	e := condExpr{parser: a, name: name, tokens: tokens}
+	b, err := e.or()
+	if err != nil {
+		return false, err
+	}
+	if t := e.peek(); t.kind != exprEnd {
+		return false, fmt.Errorf(`%s: "%s" unexpected in "%s"`, name, t.s, s)
+	}
+	return b, nil
+}
+
+// lexExpr splits s into tokens.
+func (a *Parser) lexExpr(name, s string) ([]exprToken, error) {
+	prefix := a.config.GetSpecial(SpecSymbolPrefix)
+	open := a.config.GetSpecial(SpecOpenQuote)
+	close := a.config.GetSpecial(SpecCloseQuote)
+	r := []rune(s)
+	tokens := []exprToken{}
+
+	// quoted returns the index after the quote closing the quote at i
+	quoted := func(i int) (int, error) {
+		depth := 0
+		for j := i; j < len(r); j++ {
+			switch r[j] {
+			case open:
+				depth++
+			case close:
+				depth--
+				if depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf(`%s: unbalanced quotes in "%s"`, name, s)
+	}
+
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, exprToken{kind: exprOpen, s: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, exprToken{kind: exprClose, s: ")"})
+			i++
+		case strings.ContainsRune("=!<>", c):
+			j := i + 1
+			if j < len(r) && (r[j] == '=' || r[j] == '~' && c == '=') {
+				j++
+			}
+			op := string(r[i:j])
+			if op == "=" || op == "!" {
+				return nil, fmt.Errorf(`%s: invalid operator "%s" in "%s"`, name, op, s)
+			}
+			tokens = append(tokens, exprToken{kind: exprCompare, s: op})
+			i = j
+		case c == open:
+			j, err := quoted(i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, exprToken{kind: exprQuoted, s: string(r[i+1 : j-1])})
+			i = j
+		case c == prefix && i+1 < len(r) && r[i+1] == open:
+			j, err := quoted(i + 1)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, exprToken{kind: exprSymbol, s: string(r[i+2 : j-1])})
+			i = j
+		default:
+			j := i
+			for j < len(r) && !unicode.IsSpace(r[j]) && !strings.ContainsRune("()=!<>", r[j]) && r[j] != open {
+				j++
+			}
+			word := string(r[i:j])
+			switch {
+			case word == "and":
+				tokens = append(tokens, exprToken{kind: exprAnd, s: word})
+			case word == "or":
+				tokens = append(tokens, exprToken{kind: exprOr, s: word})
+			case word == "not":
+				tokens = append(tokens, exprToken{kind: exprNot, s: word})
+			case c == prefix && j > i+1:
+				tokens = append(tokens, exprToken{kind: exprSymbol, s: string(r[i+1 : j])})
+			default:
+				tokens = append(tokens, exprToken{kind: exprWord, s: word})
+			}
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func (e *condExpr) peek() exprToken {
+	if e.pos < len(e.tokens) {
+		return e.tokens[e.pos]
+	}
+	return exprToken{kind: exprEnd}
+}
+
+func (e *condExpr) next() exprToken {
+	t := e.peek()
+	if t.kind != exprEnd {
+		e.pos++
+	}
+	return t
+}
+
+// or evaluates: and { "or" and }. Once the result is true, the remaining
+// operands are parsed but not evaluated.
+func (e *condExpr) or() (bool, error) {
+	b, err := e.and()
+	for err == nil && e.peek().kind == exprOr {
+		e.next()
+		var c bool
+		c, err = e.skipIf(b, e.and)
+		b = b || c
+	}
+	return b, err
+}
+
+// and evaluates: not { "and" not }. Once the result is false, the remaining
+// operands are parsed but not evaluated.
+func (e *condExpr) and() (bool, error) {
+	b, err := e.not()
+	for err == nil && e.peek().kind == exprAnd {
+		e.next()
+		var c bool
+		c, err = e.skipIf(!b, e.not)
+		b = b && c
+	}
+	return b, err
+}
+
+// skipIf calls f, without evaluating operands if skip is true.
+func (e *condExpr) skipIf(skip bool, f func() (bool, error)) (bool, error) {
+	if skip {
+		e.skip++
+		defer func() { e.skip-- }()
+	}
+	return f()
+}
+
+// not evaluates: "not" not | primary
+func (e *condExpr) not() (bool, error) {
+	if e.peek().kind == exprNot {
+		e.next()
+		b, err := e.not()
+		return !b, err
+	}
+	return e.primary()
+}
+
+// primary evaluates: "(" or ")" | operand [ comparison operand ]
+func (e *condExpr) primary() (bool, error) {
+	if e.peek().kind == exprOpen {
+		e.next()
+		b, err := e.or()
+		if err != nil {
+			return false, err
+		}
+		if t := e.next(); t.kind != exprClose {
+			return false, fmt.Errorf(`%s: ")" missing`, e.name)
+		}
+		return b, nil
+	}
+	left, err := e.operand()
+	if err != nil {
+		return false, err
+	}
+	if e.peek().kind != exprCompare {
+		if e.skip > 0 {
+			return false, nil
+		}
+		return left.truth()
+	}
+	op := e.next().s
+	right, err := e.operand()
+	if err != nil {
+		return false, err
+	}
+	if e.skip > 0 {
+		return false, nil
+	}
+	return compare(e.name, left, op, right)
+}
+
+// operand evaluates a symbol, a quoted string or a word. When operands are not
+// evaluated, symbols and parameters are not looked up.
+func (e *condExpr) operand() (*operand, error) {
+	t := e.next()
+	o := &operand{s: t.s, defined: true}
+	switch t.kind {
+	case exprSymbol, exprWord:
+		if e.skip > 0 {
+			break
+		}
+		if t.kind == exprWord {
+			return e.word(t.s)
+		}
+		if strings.ContainsRune(t.s, e.parser.config.modifier) {
+			// reference with a modifier
+			c := e.parser.config
+			ref := string(c.GetSpecial(SpecSymbolPrefix)) + string(c.GetSpecial(SpecOpenQuote)) + t.s + string(c.GetSpecial(SpecCloseQuote))
+			values, err := e.parser.tokens(ref, false)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", e.name, err)
+			}
+			o.s = strings.Join(values, "")
+			o.truth = func() (bool, error) { return truth(o.s), nil }
+			break
+		}
+		sv, err := e.parser.symbols.get(t.s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.name, err)
+		}
+		o.defined = sv != nil
+		if o.defined {
+			o.s = sv.s
+		} else {
+			o.s = ""
+		}
+		o.truth = func() (bool, error) { return o.defined, nil }
+	case exprQuoted:
+		o.truth = func() (bool, error) { return truth(o.s), nil }
+	case exprEnd:
+		return nil, fmt.Errorf(`%s: operand missing`, e.name)
+	default:
+		return nil, fmt.Errorf(`%s: "%s" unexpected`, e.name, t.s)
+	}
+	return o, nil
+}
+
+// word evaluates a word: a number, the boolean values true and false, and else
+// a parameter name. Other values must be quoted.
+func (e *condExpr) word(s string) (*operand, error) {
+	o := &operand{s: s, defined: true}
+	switch {
+	case s == "true" || s == "false" || isNumber(s):
+		o.truth = func() (bool, error) { return truth(s), nil }
+	default:
+		p, ok := e.parser.params[s]
+		if !ok {
+			return nil, fmt.Errorf(`%s: parameter "%s" not defined`, e.name, s)
+		}
+		o.s = fmt.Sprint(reflValue(p.target))
+		o.truth = func() (bool, error) { return p.count > 0, nil }
+	}
+	return o, nil
+}
+
+// isNumber returns true if s is a decimal number.
+func isNumber(s string) bool {
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return false
+	}
+	d := strings.TrimLeft(s, "+-")
+	return len(d) > 0 && (d[0] == '.' || d[0] >= '0' && d[0] <= '9')
+}
+
+// compare compares two operands. Comparisons with undefined symbols are false,
+// except for inequality.
+func compare(name string, left *operand, op string, right *operand) (bool, error) {
+	if !left.defined || !right.defined {
+		return op == "!=" && left.defined != right.defined, nil
+	}
+	switch op {
+	case "==":
+		return left.s == right.s, nil
+	case "!=":
+		return left.s != right.s, nil
+	case "=~":
+		re, err := regexp.Compile(right.s)
+		if err != nil {
+			return false, fmt.Errorf(`%s: compilation of "%s" failed: %v`, name, right.s, err)
+		}
+		return re.MatchString(left.s), nil
+	}
+	x, err := strconv.ParseFloat(left.s, 64)
+	if err != nil {
+		return false, fmt.Errorf(`%s: "%s" is not a number`, name, left.s)
+	}
+	y, err := strconv.ParseFloat(right.s, 64)
+	if err != nil {
+		return false, fmt.Errorf(`%s: "%s" is not a number`, name, right.s)
+	}
+	switch op {
+	case "<":
+		return x < y, nil
+	case "<=":
+		return x <= y, nil
+	case ">":
+		return x > y, nil
+	case ">=":
+		return x >= y, nil
+	}
+	return false, fmt.Errorf(`%s: invalid operator "%s"`, name, op)
+}
+
+// truth returns the truth value of a string: its boolean value if it is a
+// valid boolean, else true if it is not empty.
+func truth(s string) bool {
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b
+	}
+	return len(s) > 0
+}
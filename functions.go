@@ -0,0 +1,114 @@
+package args
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Function is the type of functions available in symbol references. A
+// function receives the value of the symbol specified as first argument and
+// the other arguments, if any. Programs can add their own functions with
+// Config.AddFunction.
+type Function func(value string, args ...string) (string, error)
+
+// builtinFunctions returns the functions built into args.
+func builtinFunctions() map[string]Function {
+	return map[string]Function{
+		"upper": func(value string, args ...string) (string, error) {
+			return strings.ToUpper(value), arguments("upper", args, 0, 0)
+		},
+		"lower": func(value string, args ...string) (string, error) {
+			return strings.ToLower(value), arguments("lower", args, 0, 0)
+		},
+		"trim": func(value string, args ...string) (string, error) {
+			if len(args) == 1 {
+				return strings.Trim(value, args[0]), nil
+			}
+			return strings.TrimSpace(value), arguments("trim", args, 0, 1)
+		},
+		"replace": func(value string, args ...string) (string, error) {
+			if err := arguments("replace", args, 2, 2); err != nil {
+				return "", err
+			}
+			return strings.ReplaceAll(value, args[0], args[1]), nil
+		},
+		"basename": func(value string, args ...string) (string, error) {
+			return filepath.Base(value), arguments("basename", args, 0, 0)
+		},
+		"dirname": func(value string, args ...string) (string, error) {
+			return filepath.Dir(value), arguments("dirname", args, 0, 0)
+		},
+		"join": func(value string, args ...string) (string, error) {
+			return filepath.Join(append([]string{value}, args...)...), nil
+		},
+	}
+}
+
+// arguments verifies the number of arguments of a function, not counting the
+// symbol.
+func arguments(name string, args []string, min, max int) error {
+	switch {
+	case len(args) < min || len(args) > max:
+		if min == max {
+			return fmt.Errorf(`function "%s": %d argument%s specified but %d expected`, name, len(args), plural(len(args)), min)
+		}
+		return fmt.Errorf(`function "%s": %d argument%s specified but %d to %d expected`, name, len(args), plural(len(args)), min, max)
+	}
+	return nil
+}
+
+// isCall returns true if s is a function call and not a symbol.
+func isCall(s string) bool {
+	return strings.IndexFunc(s, unicode.IsSpace) >= 0
+}
+
+// call evaluates a function call, consisting of a function name, a symbol and
+// optional arguments, separated by white space. Arguments are split and
+// resolved like any input. The method returns nil and no error when the symbol
+// is undefined or when an argument cannot be resolved.
+func (t *symtab) call(s string) (*symval, error) {
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	name := s[:i]
+	f, ok := t.config.functions[name]
+	if !ok {
+		return nil, fmt.Errorf(`function "%s" not defined`, name)
+	}
+	tkz := newTokenizer(t.config, t)
+	tkz.reset([]byte(s[i:]))
+	args := []string{}
+	secret := false
+	for {
+		token, sv, err := tkz.next()
+		if token == tokenError {
+			return nil, err
+		}
+		if token == tokenEqual {
+			return nil, fmt.Errorf(`function "%s": "%c" unexpected`, name, t.config.GetSpecial(SpecSeparator))
+		}
+		if token == tokenEnd {
+			break
+		}
+		if !sv.resolved {
+			return nil, nil
+		}
+		args = append(args, sv.s)
+		secret = secret || sv.secret
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf(`function "%s": symbol missing`, name)
+	}
+	sv, err := t.get(args[0])
+	if err != nil || sv == nil || !sv.resolved {
+		return nil, err
+	}
+	value, err := f(sv.s, args[1:]...)
+	if err != nil {
+		if secret || sv.secret {
+			return nil, maskError(err, append(args, sv.s)...)
+		}
+		return nil, err
+	}
+	return &symval{resolved: true, secret: secret || sv.secret, s: value}, nil
+}
@@ -0,0 +1,239 @@
+package args
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// includedFile identifies a file being included.
+type includedFile struct {
+	key  string // canonical name
+	name string // name resolved against the including file
+	os   bool   // true if read from the file system of the operating system
+}
+
+// includeStack keeps track of files being included, innermost last. It is
+// used to detect cycles and to resolve relative file names.
+type includeStack []includedFile
+
+func (s *includeStack) contains(f includedFile) bool {
+	for _, g := range *s {
+		if g.key == f.key {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *includeStack) push(f includedFile) {
+	*s = append(*s, f)
+}
+
+func (s *includeStack) pop() {
+	*s = (*s)[:len(*s)-1]
+}
+
+// dir returns the directory of the innermost file or an empty string if no
+// file is being included.
+func (s *includeStack) dir() string {
+	l := len(*s)
+	if l == 0 {
+		return ""
+	}
+	f := (*s)[l-1]
+	if f.os {
+		return filepath.Dir(f.name)
+	}
+	return path.Dir(f.name)
+}
+
+// trimBOM removes the byte order mark from data, if any.
+func trimBOM(data []byte) []byte {
+	if len(data) > 2 {
+		if data[0] == 0xef && data[1] == 0xbb && data[2] == 0xbf {
+			return data[3:]
+		}
+	}
+	return data
+}
+
+// candidates returns names to try for including the named file, in sequence.
+func (a *Parser) candidates(name string, join func(...string) string, isAbs func(string) bool) []string {
+	if isAbs(name) {
+		return []string{name}
+	}
+	names := []string{name}
+	if !a.cwd {
+		if dir := a.cycle.dir(); len(dir) > 0 {
+			names[0] = join(dir, name)
+		}
+	}
+	for _, dir := range a.incPath {
+		names = append(names, join(dir, name))
+	}
+	return names
+}
+
+// readFile reads the named file, trying candidate names in sequence as long
+// as the file does not exist. It returns the content and the identity of the
+// file. The error is the one obtained with the first candidate name.
+func (a *Parser) readFile(name string) ([]byte, includedFile, error) {
+	var first error
+	for _, n := range a.resolve(name) {
+		data, file, err := a.open(n)
+		if err == nil {
+			return data, file, nil
+		}
+		if first == nil {
+			first = err
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+	}
+	return nil, includedFile{}, first
+}
+
+// glob returns the names of files matching pattern, in lexical order,
+// ignoring directories. It tries candidate patterns in sequence until one of
+// them matches a file. With multiple file systems, matches in all file systems
+// are returned.
+func (a *Parser) glob(pattern string) ([]string, error) {
+	for _, p := range a.resolve(pattern) {
+		var names []string
+		if len(a.fs) == 0 {
+			matches, err := filepath.Glob(p)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range matches {
+				if info, err := os.Stat(m); err != nil || !info.IsDir() {
+					names = append(names, m)
+				}
+			}
+		} else {
+			seen := make(map[string]bool)
+			for _, fsys := range a.fs {
+				matches, err := fs.Glob(fsys, path.Clean(p))
+				if err != nil {
+					return nil, err
+				}
+				for _, m := range matches {
+					if info, err := fs.Stat(fsys, m); err == nil && info.IsDir() {
+						continue
+					}
+					if !seen[m] {
+						seen[m] = true
+						names = append(names, m)
+					}
+				}
+			}
+			sort.Strings(names)
+		}
+		if len(names) > 0 {
+			return names, nil
+		}
+	}
+	return nil, nil
+}
+
+// resolve returns candidate names for a file name, in sequence.
+func (a *Parser) resolve(name string) []string {
+	if len(a.fs) == 0 {
+		return a.candidates(name, filepath.Join, filepath.IsAbs)
+	}
+	return a.candidates(name, path.Join, path.IsAbs)
+}
+
+// open reads a file with a resolved name from the file systems of the parser,
+// trying them in sequence as long as the file does not exist, or, without file
+// systems, from the operating system. It returns the content and the identity
+// of the file.
+func (a *Parser) open(name string) ([]byte, includedFile, error) {
+	if len(a.fs) == 0 {
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return nil, includedFile{}, err
+		}
+		real, ok := a.permitted(abs)
+		if !ok {
+			return nil, includedFile{}, fmt.Errorf(`"%s": not in a permitted directory`, name)
+		}
+		// read the file checked, not a symbolic link which could change
+		data, err := ioutil.ReadFile(real)
+		return data, includedFile{key: abs, name: name, os: true}, err
+	}
+	name = path.Clean(name)
+	if _, ok := a.permitted(name); !ok {
+		return nil, includedFile{}, fmt.Errorf(`"%s": not in a permitted directory`, name)
+	}
+	var first error
+	for _, fsys := range a.fs {
+		data, err := fs.ReadFile(fsys, name)
+		if err == nil {
+			return data, includedFile{key: name, name: name}, nil
+		}
+		if first == nil {
+			first = err
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+	}
+	return nil, includedFile{}, first
+}
+
+// permitted returns true if the configuration permits including the file with
+// a canonical name. It also returns the name of the file to read. Symbolic
+// links are evaluated for files of the operating system so that they cannot be
+// used to escape from permitted directories, and the name returned is the
+// evaluated name which has been checked.
+func (a *Parser) permitted(name string) (string, bool) {
+	roots := a.config.incRoots
+	if roots == nil {
+		return name, true
+	}
+	if len(a.fs) > 0 {
+		for _, root := range roots {
+			root = path.Clean(root)
+			if root == "." || name == root || strings.HasPrefix(name, root+"/") {
+				return name, true
+			}
+		}
+		return name, false
+	}
+	name = evalSymlinks(name)
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		root = evalSymlinks(root)
+		if name == root || strings.HasPrefix(name, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return name, true
+		}
+	}
+	return name, false
+}
+
+// evalSymlinks returns name with symbolic links evaluated or name unchanged
+// if evaluation fails, for example because the file does not exist.
+func evalSymlinks(name string) string {
+	if s, err := filepath.EvalSymlinks(name); err == nil {
+		return s
+	}
+	return name
+}
+
+// isGlob returns true if name contains any of the special characters of a
+// pattern.
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
@@ -0,0 +1,62 @@
+package args
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// iniEntry is a key-value pair found in an INI file. The section is empty for
+// keys preceding the first section header.
+type iniEntry struct {
+	section string
+	key     string
+	value   string
+}
+
+// address returns the key qualified by the section name, if any.
+func (e *iniEntry) address() string {
+	if len(e.section) == 0 {
+		return e.key
+	}
+	return e.section + "." + e.key
+}
+
+// parseINI extracts entries from data in INI format. Section headers are
+// written [section], keys and values are separated by = or :, and lines
+// starting with ; or # are comments. White space around section names, keys
+// and values is removed, and so are matching single or double quotes around
+// values. Lines which cannot be interpreted are ignored.
+func parseINI(data []byte) []iniEntry {
+	entries := []iniEntry{}
+	section := ""
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case len(line) == 0, line[0] == ';', line[0] == '#':
+			continue
+		case line[0] == '[' && line[len(line)-1] == ']':
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i < 1 {
+			continue
+		}
+		entries = append(entries, iniEntry{
+			section: section,
+			key:     strings.TrimSpace(line[:i]),
+			value:   unquote(strings.TrimSpace(line[i+1:])),
+		})
+	}
+	return entries
+}
+
+// unquote removes matching single or double quotes around s.
+func unquote(s string) string {
+	if len(s) > 1 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
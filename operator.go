@@ -1,29 +1,42 @@
 package args
 
 import (
-	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 )
 
-type operator interface {
-	handle(value string) error
+// Operator is the interface implemented by operators. Handle receives the
+// value specified for the operator, after symbol substitution, and acts on the
+// parser which created the operator. Programs can add their own operators to a
+// configuration with Config.AddOperator.
+type Operator interface {
+	Handle(value string) error
 }
 
 // operator returns the operator with the given name or nil
-func (a *Parser) operator(name string) operator {
+func (a *Parser) operator(name string) Operator {
 	o, ok := a.config.opDict[name]
 	if ok {
+		if a.config.disabled[o] {
+			return &disabledOperator{name: name}
+		}
 		switch o {
 		case OpCond:
 			return &condOperator{parser: a}
 		case OpInclude:
 			return &includeOperator{parser: a}
+		case OpExport:
+			return &exportOperator{parser: a}
+		case OpClear:
+			return &clearOperator{parser: a}
+		case OpForeach:
+			return &foreachOperator{parser: a}
 		case OpDump:
 			return &dumpOperator{parser: a}
 		case OpImport:
@@ -34,7 +47,12 @@ func (a *Parser) operator(name string) operator {
 			return &resetOperator{parser: a}
 		case OpSkip:
 			return &skipOperator{}
+		case OpSwitch:
+			return &switchOperator{parser: a}
 		default:
+			if o >= opCustom {
+				return a.config.opCustom[o-opCustom].factory(a)
+			}
 			panic(fmt.Errorf("bug: %v (%s)", o, name)) // forgot something
 		}
 	}
@@ -42,22 +60,29 @@ func (a *Parser) operator(name string) operator {
 }
 
 // condOperator implements cond. cond has two mandatory parameters, "if" and
-// "then" and an optional one, "else". All three take exactly one value, all
-// verbatim. The value of "if" is interpreted as a parameter name or symbol. The
-// value of "if" evaluates to true if the symbol exists or if the parameter has
-// been set at least once. If the parameter has no been defined, an error
-// occurs. When the value of "if" is true then the value of "then" is parsed,
-// else the value of "else" is parsed, if specified.
+// "then", an optional parameter "elif", which can be repeated, and an optional
+// parameter "else". All take verbatim values. The values of "if" and "elif" are
+// condition expressions, evaluated in sequence until one is true. The value of
+// the corresponding "then" is parsed, where the first "then" corresponds to
+// "if", the second one to the first "elif", and so on. When no condition is
+// true, the value of "else" is parsed, if specified. The number of "then" must
+// be equal to the number of conditions. The syntax of condition expressions is
+// explained in the package documentation. In the simplest case, the expression
+// is a parameter name or symbol. It evaluates to true if the symbol exists or
+// if the parameter has been set at least once. If the parameter has no been
+// defined, an error occurs.
 type condOperator struct {
 	parser *Parser
 }
 
-func (o *condOperator) handle(value string) error {
+func (o *condOperator) Handle(value string) error {
 	local := SubParser(o.parser)
 	condIf := ""
-	condThen := ""
+	var condElif []string
+	var condThen []string
 	condElse := ""
 	local.Def("if", &condIf).Verbatim()
+	local.Def("elif", &condElif).Verbatim()
 	local.Def("then", &condThen).Verbatim()
 	local.Def("else", &condElse).Opt().Verbatim()
 	err := local.parse(value)
@@ -65,94 +90,216 @@ func (o *condOperator) handle(value string) error {
 		return err
 	}
 
-	ifVal, isSymbol := symbol(condIf, o.parser)
-	var cond bool
-
-	if isSymbol {
-		_, cond = o.parser.symbols.table[ifVal]
-	} else {
-		p, ok := o.parser.params[ifVal]
-		if !ok {
-			return fmt.Errorf(`cond/if: parameter "%s" not defined`, ifVal)
-		}
-		cond = ok && p.count > 0
+	conditions := append([]string{condIf}, condElif...)
+	if len(condThen) != len(conditions) {
+		return fmt.Errorf(`cond: %d then specified but %d expected`, len(condThen), len(conditions))
 	}
-	if cond {
-		return o.parser.parse(condThen)
+	for i, c := range conditions {
+		name := "cond/if"
+		if i > 0 {
+			name = "cond/elif"
+		}
+		cond, err := o.parser.evaluate(name, c)
+		if err != nil {
+			return err
+		}
+		if cond {
+			o.parser.trace("cond", "branch", "then", "index", i)
+			return o.parser.parseScoped(condThen[i])
+		}
 	}
 	if len(condElse) > 0 {
-		return o.parser.parse(condElse)
+		o.parser.trace("cond", "branch", "else")
+		return o.parser.parseScoped(condElse)
 	}
+	o.parser.trace("cond", "branch", "none")
 	return nil
 }
 
-// dumpOperator implements dump. dump takes an optional "comment" parameter and
-// a series of anonymous values. All values are taken verbatim. dump interprets
-// the values as parameter names and symbols and prints them line by line on
-// standard error with their current values. The value of a symbol is preceded
-// by R if resolved, else by U. A name or symbol is preceded by ? if undefined.
-// If a comment is specified, it is printed first.
+// dumpOperator implements dump. dump takes an optional "comment" parameter, an
+// optional "format" parameter, a standalone "all" parameter, and a series of
+// anonymous values. All values are taken verbatim. dump interprets the values
+// as parameter names and symbols and prints them line by line with their
+// current values on the writer set with Parser.SetDumpWriter, by default
+// standard error. With all, it prints the values specified, followed by all
+// other parameters, without synonyms, in definition sequence and all other
+// symbols in alphabetical order. If a comment is specified, it is printed
+// first.
+//
+// In text format, the default, the value of a symbol is preceded by R if
+// resolved, else by U. A name or symbol is preceded by ? if undefined. In json
+// format, each line is a JSON object with name, kind (comment, parameter, or
+// symbol), value, resolved, and defined members. The value of a parameter with
+// an array or slice target is an array. When the parser has a logger and no
+// writer, records are logged with the same attributes.
 type dumpOperator struct {
 	parser *Parser
 }
 
-func (o *dumpOperator) handle(value string) error {
+// dumpRecord describes a parameter, a symbol, or a comment printed by dump.
+type dumpRecord struct {
+	Name     string      `json:"name"`
+	Kind     string      `json:"kind"`
+	Value    interface{} `json:"value"`
+	Resolved bool        `json:"resolved"`
+	Defined  bool        `json:"defined"`
+}
+
+func (o *dumpOperator) Handle(value string) error {
 	local := SubParser(o.parser)
 	comment := ""
+	format := "text"
+	all := false
 	var names []string
 	local.Def("", &names).Verbatim()
 	local.Def("comment", &comment).Opt().Verbatim()
-	local.parse(value)
+	local.Def("format", &format).Opt().Verbatim()
+	local.Def("all", &all).Opt()
+	err := local.parse(value)
+	if err != nil {
+		return err
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf(`dump: format "%s" invalid (text or json expected)`, format)
+	}
+	if all {
+		// names specified explicitly come first, synonyms are omitted
+		listed := make(map[string]bool, len(names))
+		for _, n := range names {
+			listed[n] = true
+		}
+		add := func(n string) {
+			if !listed[n] {
+				listed[n] = true
+				names = append(names, n)
+			}
+		}
+		for _, n := range o.parser.seq {
+			if n == o.parser.params[n].name {
+				add(n)
+			}
+		}
+		prefix := string(o.parser.config.GetSpecial(SpecSymbolPrefix))
+		for _, s := range o.parser.symbols.names() {
+			add(prefix + s)
+		}
+	}
+
+	records := []dumpRecord{}
 	if len(comment) > 0 {
-		fmt.Fprintln(os.Stderr, comment)
+		records = append(records, dumpRecord{Kind: "comment", Value: comment, Resolved: true, Defined: true})
 	}
 	for _, n := range names {
+		r := dumpRecord{Name: n}
 		if s, isSymbol := symbol(n, o.parser); isSymbol {
-			if v, ok := o.parser.symbols.table[s]; ok {
-				r := 'U'
-				if v.resolved {
-					r = 'R'
+			r.Kind = "symbol"
+			if v, _ := o.parser.symbols.lookup(s); v != nil {
+				r.Value, r.Resolved, r.Defined = v.s, v.resolved, true
+				if v.secret {
+					r.Value = mask
 				}
-				fmt.Fprintf(os.Stderr, "%s %c %s\n", n, r, v.s)
-			} else {
-				fmt.Fprintf(os.Stderr, "? %s\n", n)
 			}
 		} else {
+			r.Kind = "parameter"
 			if p, ok := o.parser.params[n]; ok {
-				if len(n) == 0 {
-					n = "[]"
+				r.Value, r.Resolved, r.Defined = dumpValue(p), true, true
+				if p.secret {
+					r.Value = mask
 				}
-				fmt.Fprintf(os.Stderr, "%s %v\n", n, reflValue(p.target))
-			} else {
-				if len(n) == 0 {
-					n = "[]"
-				}
-				fmt.Fprintf(os.Stderr, "? %s\n", n)
 			}
 		}
+		records = append(records, r)
+	}
+
+	w := o.parser.dump
+	if w == nil && o.parser.logger != nil {
+		for _, r := range records {
+			o.parser.logger.Info("dump", "name", r.Name, "kind", r.Kind, "value", r.Value, "resolved", r.Resolved, "defined", r.Defined)
+		}
+		return nil
+	}
+	if w == nil {
+		w = os.Stderr
+	}
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return fmt.Errorf("dump: %v", err)
+			}
+		}
+		return nil
+	}
+	for _, r := range records {
+		n := r.Name
+		if len(n) == 0 {
+			n = "[]"
+		}
+		switch {
+		case r.Kind == "comment":
+			_, err = fmt.Fprintln(w, r.Value)
+		case !r.Defined:
+			_, err = fmt.Fprintf(w, "? %s\n", n)
+		case r.Kind == "symbol" && r.Resolved:
+			_, err = fmt.Fprintf(w, "%s R %s\n", n, r.Value)
+		case r.Kind == "symbol":
+			_, err = fmt.Fprintf(w, "%s U %s\n", n, r.Value)
+		case r.Value == mask:
+			_, err = fmt.Fprintf(w, "%s %s\n", n, mask)
+		default:
+			_, err = fmt.Fprintf(w, "%s %v\n", n, reflValue(o.parser.params[r.Name].target))
+		}
+		if err != nil {
+			return fmt.Errorf("dump: %v", err)
+		}
 	}
 	return nil
 }
 
+// dumpValue returns the value of a parameter for dump: a string, or a slice of
+// strings when the target is an array or a slice.
+func dumpValue(p *Param) interface{} {
+	v := reflValue(p.target)
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = fmt.Sprint(v.Index(i))
+		}
+		return values
+	}
+	return fmt.Sprint(v)
+}
+
 // importOperator implements import. import takes a series of verbatim values,
 // which it interprets as symbols. For each symbol a value is taken from the
 // environment variable with the corresponding name (smybol prefix removed). The
 // value is inserted in the symbol table unless there is already an entry for
 // the symbol ("first wins" principle). If the environment variable does not
-// exist,nothing is done.
+// exist,nothing is done. An error occurs if the configuration restricts import
+// and does not permit the variable.
 type importOperator struct {
 	parser *Parser
 }
 
-func (o *importOperator) handle(value string) error {
+func (o *importOperator) Handle(value string) error {
 	local := SubParser(o.parser)
 	var symbols []string
+	secret := false
 	local.Def("", &symbols).Verbatim()
+	local.Def("secret", &secret).Opt()
 	local.parse(value)
 	for _, sym := range symbols {
 		if k, isSymbol := symbol(sym, o.parser); isSymbol {
-			if v, ok := os.LookupEnv(k); ok {
-				o.parser.symbols.put(sym, v)
+			if env := o.parser.config.envNames; env != nil && !env[k] {
+				return fmt.Errorf(`import: "%s": environment variable not permitted`, sym)
+			}
+			v, ok := os.LookupEnv(k)
+			o.parser.trace("import", "variable", k, "found", ok)
+			if ok {
+				if _, err := o.parser.symbols.putSecret(sym, v, secret); err != nil {
+					return fmt.Errorf("import: %v", err)
+				}
 			}
 		} else {
 			return fmt.Errorf(`import: "%s": symbol prefix missing (%c)`, sym, o.parser.config.GetSpecial(SpecSymbolPrefix))
@@ -161,10 +308,14 @@ func (o *importOperator) handle(value string) error {
 	return nil
 }
 
-// includeOperator implements include. include works in two different modes.
+// includeOperator implements include. include works in three different modes.
 //
 // In basic mode, include takes a file name from a mandatory and anonymous
-// parameter. It reads the file and passes its content to Parse.
+// parameter. It reads the file and passes its content to Parse. Files are read
+// from the file systems configured with Parser.SetFS or else from the
+// operating system. A relative file name in an included file is resolved
+// against the directory of that file, then against the directories of the
+// include path.
 //
 // In key selection mode include takes a file name as in the first mode, but
 // takes also a "keys" parameter and an optional "extractor" parameter. The
@@ -178,56 +329,187 @@ func (o *importOperator) handle(value string) error {
 //
 //The "extractor" parameter specifies a custom regular expression for extracting
 //key-value pairs. The default extractor is \s*(\S+)\s*=\s*(\S+)\s*. It is an
-//error to specify an extractor in basic mode (no keys specified).
+//error to specify an extractor in basic mode (no keys specified). The extractor
+//must have either exactly two capture groups, or groups named "key" and
+//"value", in which case any number of other groups is allowed. By default only
+//the first match in each line is used. The standalone "all" parameter selects
+//all matches in each line, and the standalone "whole" parameter selects all
+//matches in the whole file, which allows values spanning multiple lines.
+//
+// In INI mode, selected with the standalone "ini" parameter, the file is read
+// as an INI file with sections. Keys are addressed as section.key, or simply
+// as key before the first section header. The optional "sections" parameter
+// takes a series of standalone section names or section-translation pairs. The
+// translation is the name of a parameter with a map target and all key-value
+// pairs of the section are put into the map. It is an error to specify both
+// "ini" and "extractor", and to specify "sections" without "ini".
+//
+// In all modes, the standalone "optional" parameter specifies that a missing
+// file is silently skipped. A file name containing any of the characters *, ?
+// and [ is a pattern (see path.Match), and all matching files are included in
+// lexical order. Cycles are detected for each of them. A pattern matching no
+// file is an error, unless "optional" is specified.
 //
-// Keys are taken verbatim, but the file name and the extractor are resolved.
+// An error occurs if the configuration restricts include and the file is not
+// in a permitted directory.
+//
+// Keys and sections are taken verbatim, but the file name and the extractor
+// are resolved.
 type includeOperator struct {
-	parser *Parser
+	parser    *Parser
+	keys      string
+	sections  string
+	extractor string
+	ini       bool
+	all       bool
+	whole     bool
+	secret    bool
 }
 
-func (o *includeOperator) handle(value string) error {
+func (o *includeOperator) Handle(value string) error {
 	local := SubParser(o.parser)
 	filename := ""
-	keys := ""
-	extractor := ""
+	optional := false
 	local.Def("", &filename)
-	local.Def("keys", &keys).Opt().Verbatim()
-	local.Def("extractor", &extractor).Opt()
-	local.parse(value)
+	local.Def("keys", &o.keys).Opt().Verbatim()
+	local.Def("sections", &o.sections).Opt().Verbatim()
+	local.Def("extractor", &o.extractor).Opt()
+	local.Def("ini", &o.ini).Opt()
+	local.Def("all", &o.all).Opt()
+	local.Def("whole", &o.whole).Opt()
+	local.Def("secret", &o.secret).Opt()
+	local.Def("optional", &optional).Opt()
+	if err := local.parse(value); err != nil {
+		return err
+	}
 
-	// detect cycles using canonical file name
-	path, err := filepath.Abs(filename)
+	switch {
+	case len(o.extractor) > 0 && o.ini:
+		return fmt.Errorf("include: specify either ini or extractor")
+	case len(o.sections) > 0 && !o.ini:
+		return fmt.Errorf("include: specify sections only with ini")
+	case (o.all || o.whole) && (o.ini || len(o.keys) == 0):
+		return fmt.Errorf("include: specify all and whole only in key selection mode")
+	case len(o.keys) == 0 && len(o.sections) == 0:
+		if len(o.extractor) > 0 {
+			return fmt.Errorf("include: specify extractor only with keys parameter")
+		}
+		if o.ini {
+			return fmt.Errorf("include: specify ini only with keys or sections parameter")
+		}
+		if o.secret {
+			return fmt.Errorf("include: specify secret only with keys or sections parameter")
+		}
+	}
+
+	if !isGlob(filename) {
+		data, file, err := o.parser.readFile(filename)
+		if err != nil {
+			if optional && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("include: %v", err)
+		}
+		return o.include(data, file)
+	}
+
+	names, err := o.parser.glob(filename)
 	if err != nil {
-		return err
+		return fmt.Errorf("include: %v", err)
+	}
+	if len(names) == 0 && !optional {
+		return fmt.Errorf(`include: no file matches "%s"`, filename)
+	}
+	for _, name := range names {
+		data, file, err := o.parser.open(name)
+		if err != nil {
+			return fmt.Errorf("include: %v", err)
+		}
+		if err := o.include(data, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// include processes the data of an included file.
+func (o *includeOperator) include(data []byte, file includedFile) error {
+
+	o.parser.usage.includes++
+	if max := o.parser.config.limits[LimitIncludes]; max > 0 && o.parser.usage.includes > max {
+		return limitError(fmt.Sprintf(`include: "%s": number of included files exceeds limit of %d`, file.name, max))
 	}
-	if _, ok := o.parser.cycle[path]; ok {
-		return fmt.Errorf(`cyclical include dependency with file "%s"`, filename)
+
+	// detect cycles using canonical file name
+	if o.parser.cycle.contains(file) {
+		return fmt.Errorf(`cyclical include dependency with file "%s"`, file.name)
 	}
-	o.parser.cycle[path] = true
-	defer func() {
-		delete(o.parser.cycle, path)
-	}()
+	o.parser.cycle.push(file)
+	defer o.parser.cycle.pop()
+	o.parser.trace("include", "file", o.parser.symbols.maskString(file.name))
+
+	data = trimBOM(data)
 
 	// standard mode: parse the file
-	if len(keys) == 0 {
-		if len(extractor) > 0 {
-			return fmt.Errorf("include: specify extractor only with keys parameter")
+	if len(o.keys) == 0 && len(o.sections) == 0 {
+		if o.parser.symbols.scoped {
+			o.parser.symbols.pushScope(make(map[string]*symval))
+			defer o.parser.symbols.popScope()
 		}
-		data, e := ioutil.ReadFile(path)
-		if e != nil {
-			return fmt.Errorf("include: %v", e)
+		return o.parser.parseBytes(data)
+	}
+
+	kvmap, err := o.translations(o.keys)
+	if err != nil {
+		return err
+	}
+
+	// INI mode
+
+	if o.ini {
+		secmap, err := o.translations(o.sections)
+		if err != nil {
+			return err
 		}
-		// remove byte order mark if any
-		if len(data) > 2 {
-			if data[0] == 0xef && data[1] == 0xbb || data[2] == 0xbf {
-				data = data[3:]
+		targets := make(map[string]*Param, len(secmap))
+		for s, n := range secmap {
+			p, ok := o.parser.params[n]
+			if !ok || reflValue(p.target).Kind() != reflect.Map {
+				return fmt.Errorf(`include: section "%s": "%s" is not a parameter with a map target`, s, n)
 			}
+			targets[s] = p
 		}
-		return o.parser.parseBytes(data)
+		cleared := make(map[*Param]bool)
+		for _, e := range parseINI(data) {
+			if name, ok := kvmap[e.address()]; ok {
+				if err := o.set(name, e.value); err != nil {
+					return err
+				}
+			}
+			if p, ok := targets[e.section]; ok {
+				if p.replace && !cleared[p] {
+					p.clear()
+					cleared[p] = true
+				}
+				p.secret = p.secret || o.secret
+				if err := convertKeyValue(e.key, e.value, p.target); err != nil {
+					if p.secret {
+						err = maskError(err, e.value)
+					}
+					return decorate(err, p.name)
+				}
+				p.count++
+				if err := p.notify(fmt.Sprintf("%s%c%s", e.key, o.parser.config.GetSpecial(SpecSeparator), e.value)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
 	}
 
 	// key selection mode
 
+	extractor := o.extractor
 	if len(extractor) == 0 {
 		extractor = `\s*(\S+)\s*=\s*(\S+)\s*`
 	}
@@ -236,20 +518,56 @@ func (o *includeOperator) handle(value string) error {
 	if err != nil {
 		return fmt.Errorf(`compilation of extractor "%s" failed: %v`, extractor, err)
 	}
+	ki, vi := re.SubexpIndex("key"), re.SubexpIndex("value")
+	if ki < 0 || vi < 0 {
+		if re.NumSubexp() != 2 {
+			return fmt.Errorf(`include: extractor "%s" must have 2 capture groups or groups named key and value`, extractor)
+		}
+		ki, vi = 1, 2
+	}
 
+	var inputs []string
+	if o.whole {
+		inputs = []string{string(data)}
+	} else {
+		inputs = strings.SplitAfter(string(data), "\n")
+	}
+
+	for _, input := range inputs {
+		var captures [][]string
+		if o.all || o.whole {
+			captures = re.FindAllStringSubmatch(input, -1)
+		} else if capture := re.FindStringSubmatch(input); capture != nil {
+			captures = [][]string{capture}
+		}
+		for _, capture := range captures {
+			if name, ok := kvmap[capture[ki]]; ok {
+				if err := o.set(name, capture[vi]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// translations interprets s as a series of standalone keys or key-translation
+// pairs and returns a map of keys to translations.
+func (o *includeOperator) translations(s string) (map[string]string, error) {
 	kvmap := make(map[string]string)
-	nvp := newNameValParser(o.parser, []byte(keys))
+	nvp := newNameValParser(o.parser, []byte(s))
 	for {
 		n, v, e := nvp.next()
 		if e != nil {
-			return e
+			return nil, e
 		}
 		if n == nil && v == nil {
 			break
 		}
 
 		if !v.resolved {
-			return fmt.Errorf(`include: cannot resolve key "%s"`, v.s)
+			return nil, fmt.Errorf(`include: cannot resolve key "%s"`, v.s)
 		}
 
 		if n == nil {
@@ -258,56 +576,60 @@ func (o *includeOperator) handle(value string) error {
 			kvmap[n.s] = v.s
 		}
 	}
+	return kvmap, nil
+}
 
-	f, err := os.Open(filename)
-	if err != nil {
-		return err
-	}
-
-	r := bufio.NewReader(f)
-
-loop:
-	for {
-		line, e := r.ReadString('\n')
-		switch e {
-		case nil:
-		case io.EOF:
-			if len(line) == 0 {
-				break loop
-			}
-		default:
-			return e
-		}
-
-		capture := re.FindStringSubmatch(line)
-		if len(capture) == 3 {
-			if name, ok := kvmap[capture[1]]; ok {
-				o.parser.setValue(&symval{resolved: true, s: name}, &symval{resolved: true, s: capture[2]})
-			}
-		}
-	}
-
-	return nil
+// set sets a parameter or a symbol with a value extracted from a file.
+func (o *includeOperator) set(name, value string) error {
+	return o.parser.setValue(&symval{resolved: true, s: name}, &symval{resolved: true, s: value, secret: o.secret})
 }
 
 // macroOperator implements macro. macro takes a series of values verbatim,
 // which it interprets as symbols, gets their values from the symbol table
-// without resolving them, and passes them recursively to Parse. An error occurs
-// if values are not symbols, if any symbol is not found, or if parsing fails.
+// without resolving them, and passes them recursively to Parse. Name-value
+// pairs are arguments. They are bound as local symbols, visible only while
+// parsing the values of the symbols. An error occurs if values are not
+// symbols, if any symbol is not found, if an argument name is invalid, or if
+// parsing fails.
 type macroOperator struct {
 	parser *Parser
 }
 
-func (o *macroOperator) handle(value string) error {
-	local := SubParser(o.parser)
+func (o *macroOperator) Handle(value string) error {
 	var symbols []string
-	local.Def("", &symbols).Verbatim()
-	local.parse(value)
+	args := make(map[string]*symval)
+	nvp := newNameValParser(o.parser, []byte(value))
+	for {
+		name, value, err := nvp.next()
+		if err != nil {
+			return fmt.Errorf("macro: %v", err)
+		}
+		if value == nil {
+			break
+		}
+		if name == nil {
+			symbols = append(symbols, value.s)
+			continue
+		}
+		if len(name.s) == 0 {
+			return fmt.Errorf(`macro: argument name missing`)
+		}
+		if err := validate(name.s); err != nil {
+			return fmt.Errorf("macro: %v", err)
+		}
+		if _, ok := args[name.s]; !ok {
+			args[name.s] = &symval{s: value.s}
+		}
+	}
 	code := []string{}
+	secrets := []string{}
 	for _, s := range symbols {
 		if sym, isSymbol := symbol(s, o.parser); isSymbol {
-			if v, ok := o.parser.symbols.table[sym]; ok {
+			if v, _ := o.parser.symbols.lookup(sym); v != nil {
 				code = append(code, v.s)
+				if v.secret {
+					secrets = append(secrets, v.s)
+				}
 			} else {
 				return fmt.Errorf(`macro: symbol "%s" undefined`, s)
 			}
@@ -315,10 +637,18 @@ func (o *macroOperator) handle(value string) error {
 			return fmt.Errorf(`macro: "%s": symbol prefix missing (%c)`, s, o.parser.config.GetSpecial(SpecSymbolPrefix))
 		}
 	}
+	o.parser.trace("macro", "symbols", symbols, "arguments", len(args))
+	if len(args) > 0 || o.parser.symbols.scoped {
+		o.parser.symbols.pushScope(args)
+		defer o.parser.symbols.popScope()
+	}
 	// do not use ParseStrings here, it does final verification
 	err := o.parser.parse(strings.Join(code, " "))
 	if err != nil {
-		return fmt.Errorf(`macro: parsing of %v failed %v`, code, err)
+		if _, ok := err.(limitError); ok {
+			return err
+		}
+		return maskError(fmt.Errorf(`macro: parsing of %v failed %v`, code, err), secrets...)
 	}
 	return nil
 }
@@ -330,14 +660,15 @@ type resetOperator struct {
 	parser *Parser
 }
 
-func (o *resetOperator) handle(value string) error {
+func (o *resetOperator) Handle(value string) error {
 	local := SubParser(o.parser)
 	var symbols []string
 	local.Def("", &symbols).Verbatim()
 	local.parse(value)
 	for _, s := range symbols {
 		if sym, isSymbol := symbol(s, o.parser); isSymbol {
-			delete(o.parser.symbols.table, sym)
+			o.parser.trace("reset", "symbol", s)
+			o.parser.symbols.remove(sym)
 		} else {
 			return fmt.Errorf(`reset: "%s": symbol prefix missing (%c)`, s, o.parser.config.GetSpecial(SpecSymbolPrefix))
 		}
@@ -350,10 +681,259 @@ func (o *resetOperator) handle(value string) error {
 type skipOperator struct {
 }
 
-func (o *skipOperator) handle(value string) error {
+func (o *skipOperator) Handle(value string) error {
+	return nil
+}
+
+// exportOperator implements export. export takes a series of values verbatim,
+// which it interprets as symbols, and copies them from the scope where they are
+// visible to the global symbol table, unless they are already there ("first
+// wins" principle). The resolved value is copied when possible. An error
+// occurs if values are not symbols or if any symbol is not found.
+type exportOperator struct {
+	parser *Parser
+}
+
+func (o *exportOperator) Handle(value string) error {
+	local := SubParser(o.parser)
+	var symbols []string
+	local.Def("", &symbols).Verbatim()
+	local.parse(value)
+	for _, s := range symbols {
+		sym, isSymbol := symbol(s, o.parser)
+		if !isSymbol {
+			return fmt.Errorf(`export: "%s": symbol prefix missing (%c)`, s, o.parser.config.GetSpecial(SpecSymbolPrefix))
+		}
+		o.parser.trace("export", "symbol", s)
+		ok, err := o.parser.symbols.export(sym)
+		if err != nil {
+			return fmt.Errorf("export: %v", err)
+		}
+		if !ok {
+			return fmt.Errorf(`export: symbol "%s" undefined`, s)
+		}
+	}
+	return nil
+}
+
+// clearOperator implements clear. clear takes a series of values verbatim,
+// which it interprets as names of parameters with a slice or a map target, and
+// removes all their values, including default values. An error occurs if a
+// parameter is not defined or if its target is neither a slice nor a map.
+type clearOperator struct {
+	parser *Parser
+}
+
+func (o *clearOperator) Handle(value string) error {
+	local := SubParser(o.parser)
+	var names []string
+	local.Def("", &names).Verbatim()
+	if err := local.parse(value); err != nil {
+		return err
+	}
+	for _, n := range names {
+		p, ok := o.parser.params[n]
+		if !ok {
+			return fmt.Errorf(`clear: parameter "%s" not defined`, n)
+		}
+		o.parser.trace("clear", "parameter", n)
+		if !p.clear() {
+			return fmt.Errorf(`clear: parameter "%s" is neither a slice nor a map`, n)
+		}
+	}
+	return nil
+}
+
+// foreachOperator implements foreach. foreach takes a "var" parameter, a symbol,
+// an "in" parameter, which can be repeated, and a "do" parameter, all verbatim.
+// The values of "in" are split into a list of values like the input of the
+// parser, or with the regular expression of the optional "split" parameter.
+// For each value in the list, the symbol is bound to the value as a local
+// symbol and the value of "do" is parsed. The value of foreach is taken
+// literally, so that "do" is substituted only once per value, with the symbol
+// bound.
+type foreachOperator struct {
+	parser *Parser
+}
+
+func (o *foreachOperator) Handle(value string) error {
+	local := SubParser(o.parser)
+	variable := ""
+	var in []string
+	split := ""
+	do := ""
+	local.Def("var", &variable).Verbatim()
+	local.Def("in", &in).Verbatim()
+	local.Def("split", &split).Opt().Verbatim()
+	local.Def("do", &do).Verbatim()
+	err := local.parse(value)
+	if err != nil {
+		return err
+	}
+
+	sym, isSymbol := symbol(variable, o.parser)
+	if !isSymbol {
+		return fmt.Errorf(`foreach: "%s": symbol prefix missing (%c)`, variable, o.parser.config.GetSpecial(SpecSymbolPrefix))
+	}
+	if err := validate(sym); err != nil {
+		return fmt.Errorf("foreach: %v", err)
+	}
+	var splitter *regexp.Regexp
+	if len(split) > 0 {
+		splitter, err = regexp.Compile(split)
+		if err != nil {
+			return fmt.Errorf(`foreach: compilation of split expression "%s" failed: %v`, split, err)
+		}
+	}
+	values := []string{}
+	for _, s := range in {
+		if splitter != nil {
+			s, err := o.parser.substitute(s)
+			if err != nil {
+				return fmt.Errorf("foreach/in: %v", err)
+			}
+			values = append(values, splitter.Split(s, -1)...)
+			continue
+		}
+		v, err := o.parser.tokens(s, false)
+		if err != nil {
+			return fmt.Errorf("foreach/in: %v", err)
+		}
+		values = append(values, v...)
+	}
+
+	for i, v := range values {
+		o.parser.trace("foreach", "symbol", variable, "iteration", i+1)
+		o.parser.symbols.pushScope(map[string]*symval{sym: {resolved: true, s: v}})
+		err := o.parser.parse(do)
+		o.parser.symbols.popScope()
+		if err != nil {
+			if _, ok := err.(limitError); ok {
+				return err
+			}
+			return fmt.Errorf(`foreach: parsing for value "%s" failed: %v`, v, err)
+		}
+	}
 	return nil
 }
 
+// switchOperator implements switch. switch takes an anonymous value, the
+// subject, a series of "case" values and an optional "default" value, all
+// verbatim. The subject is a symbol or a parameter name. Each case consists of
+// a value followed by a block between quotes. The block of the first case
+// with a value equal to the value of the subject is parsed. If there is no
+// such case, the value of "default" is parsed, if specified. An undefined
+// symbol matches no case, and an undefined parameter is an error. The value of
+// switch is taken literally, so that blocks are substituted only once.
+type switchOperator struct {
+	parser *Parser
+}
+
+func (o *switchOperator) Handle(value string) error {
+	local := SubParser(o.parser)
+	subject := ""
+	var cases []string
+	deflt := ""
+	local.Def("", &subject).Verbatim()
+	local.Def("case", &cases).Verbatim()
+	local.Def("default", &deflt).Opt().Verbatim()
+	err := local.parse(value)
+	if err != nil {
+		return err
+	}
+
+	var s string
+	defined, secret := true, false
+	if sym, isSymbol := symbol(subject, o.parser); isSymbol {
+		sv, err := o.parser.symbols.get(sym)
+		if err != nil {
+			return fmt.Errorf("switch: %v", err)
+		}
+		if sv != nil {
+			s, secret = sv.s, sv.secret
+		} else {
+			defined = false
+		}
+	} else {
+		p, ok := o.parser.params[subject]
+		if !ok {
+			return fmt.Errorf(`switch: parameter "%s" not defined`, subject)
+		}
+		s, secret = fmt.Sprint(reflValue(p.target)), p.secret
+	}
+
+	for _, c := range cases {
+		values, err := o.parser.tokens(c, true)
+		if err != nil {
+			return fmt.Errorf("switch/case: %v", err)
+		}
+		if len(values) != 2 {
+			return fmt.Errorf(`switch/case: value and block expected in "%s"`, c)
+		}
+		values[0], err = o.parser.substitute(values[0])
+		if err != nil {
+			return fmt.Errorf("switch/case: %v", err)
+		}
+		if defined && values[0] == s {
+			c := o.parser.symbols.maskString(values[0])
+			if secret {
+				c = mask
+			}
+			o.parser.trace("switch", "subject", subject, "case", c)
+			return o.parser.parseScoped(values[1])
+		}
+	}
+	if len(deflt) > 0 {
+		o.parser.trace("switch", "subject", subject, "case", "default")
+		return o.parser.parseScoped(deflt)
+	}
+	o.parser.trace("switch", "subject", subject, "case", "none")
+	return nil
+}
+
+// disabledOperator replaces an operator disabled in the configuration. It
+// fails whenever it is used.
+type disabledOperator struct {
+	name string
+}
+
+func (o *disabledOperator) Handle(value string) error {
+	return fmt.Errorf(`operator "%s" is disabled`, o.name)
+}
+
+// tokens splits s into values, using the same rules as for the input of the
+// parser. Symbol references are resolved when possible, unless literal is
+// true. It is an error if s contains a separator.
+func (a *Parser) tokens(s string, literal bool) ([]string, error) {
+	t := newTokenizer(a.config, &a.symbols)
+	t.reset([]byte(s))
+	values := []string{}
+	for {
+		t.literal = literal
+		token, sv, err := t.next()
+		switch token {
+		case tokenError:
+			return nil, err
+		case tokenEqual:
+			return nil, fmt.Errorf(`"%c" unexpected in "%s"`, a.config.GetSpecial(SpecSeparator), s)
+		case tokenString:
+			values = append(values, sv.s)
+			continue
+		}
+		return values, nil
+	}
+}
+
+// substitute returns s with symbol references resolved when possible.
+func (a *Parser) substitute(s string) (string, error) {
+	c := a.config
+	values, err := a.tokens(string(c.GetSpecial(SpecOpenQuote))+s+string(c.GetSpecial(SpecCloseQuote)), false)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(values, ""), nil
+}
+
 // symbols returns s without the symbol prefix and true if s starts with the
 // symbol prefix else it returns s and false.
 func symbol(s string, p *Parser) (string, bool) {
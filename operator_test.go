@@ -1,10 +1,13 @@
 package args_test
 
 import (
+	"bytes"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/jpvetterli/args"
 )
@@ -222,6 +225,41 @@ func TestOperatorIncludeEmptyBOMFile(t *testing.T) {
 	}
 }
 
+func TestOperatorIncludeNoBOM(t *testing.T) {
+	a := getParser()
+	s := ""
+	a.Def("", &s)
+	// the third byte of the file is the last byte of a byte order mark
+	if err := matchResult(
+		a.Parse("include=[testdata/include-no-BOM.test]"),
+		func() error {
+			if s != "a\u00bf" {
+				return fmt.Errorf(`unexpected result: "%s"`, s)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorIncludeErrors(t *testing.T) {
+	a := getParser()
+	port := 0
+	a.Def("port", &port).Opt()
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/include-empty.test nonesuch=y]"),
+		`parameter not defined: "nonesuch"`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/port.test keys=[port]]"),
+		`Parse error on port: strconv.ParseInt: parsing "abc": invalid syntax`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
 func TestOperatorIncludeBeforeSet(t *testing.T) {
 
 	a := getParser()
@@ -489,6 +527,143 @@ func TestOperatorDumpWithNoEmpty(t *testing.T) {
 	}
 }
 
+func TestOperatorDumpWriter(t *testing.T) {
+	a := getParser()
+	var buf bytes.Buffer
+	a.SetDumpWriter(&buf)
+	foo := ""
+	var bar []int
+	a.Def("foo", &foo)
+	a.Def("bar", &bar)
+	input := "foo=x bar=1 bar=2 $S=[a $[T]] $T=t dump=[comment=start foo bar $S $T $U quux]"
+	expected := "start\nfoo x\nbar [1 2]\n$S U a $[T]\n$T U t\n? $U\n? quux\n"
+	if err := a.Parse(input); err != nil {
+		t.Error(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("unexpected output of dump: %s", buf.String())
+	}
+
+	buf.Reset()
+	expected = `{"name":"","kind":"comment","value":"start","resolved":true,"defined":true}
+{"name":"foo","kind":"parameter","value":"x","resolved":true,"defined":true}
+{"name":"bar","kind":"parameter","value":["1","2"],"resolved":true,"defined":true}
+{"name":"$S","kind":"symbol","value":"a $[T]","resolved":false,"defined":true}
+{"name":"$T","kind":"symbol","value":"t","resolved":false,"defined":true}
+{"name":"$U","kind":"symbol","value":null,"resolved":false,"defined":false}
+{"name":"quux","kind":"parameter","value":null,"resolved":false,"defined":false}
+`
+	if err := a.Parse("dump=[format=json comment=start foo bar $S $T $U quux]"); err != nil {
+		t.Error(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("unexpected output of dump: %s", buf.String())
+	}
+
+	buf.Reset()
+	expected = "foo x\nbar [1 2]\n$S U a $[T]\n$T U t\n"
+	if err := a.Parse("dump=all"); err != nil {
+		t.Error(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("unexpected output of dump: %s", buf.String())
+	}
+
+	buf.Reset()
+	a = getParser()
+	a.SetDumpWriter(&buf)
+	verbose := false
+	a.Def("foo", &foo).Aka("f")
+	a.Def("verbose", &verbose).Opt().Negatable()
+	expected = "$T U t\n? quux\nfoo y\nverbose false\n$S U s\n"
+	if err := a.Parse("foo=y $S=s $T=t dump=[$T quux all]"); err != nil {
+		t.Error(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("unexpected output of dump: %s", buf.String())
+	}
+
+	if err := matchErrorMessage(a.Parse("dump=[format=xml]"), `dump: format "xml" invalid (text or json expected)`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorTrace(t *testing.T) {
+	a := getParser()
+	var buf bytes.Buffer
+	a.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+	foo := ""
+	bar := ""
+	a.Def("foo", &foo)
+	a.Def("bar", &bar).Opt()
+	if err := a.Parse("$X=1 cond=[if=$X then=[foo=x] else=[foo=y]] dump=[foo $X]"); err != nil {
+		t.Error(err)
+	}
+	expected := `level=INFO msg=dump name=foo kind=parameter value=x resolved=true defined=true
+level=INFO msg=dump name=$X kind=symbol value=1 resolved=true defined=true
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected log: %s", buf.String())
+	}
+
+	buf.Reset()
+	a.SetTrace(true)
+	if err := a.Parse("$M=[foo=$[Y]] macro=[$M Y=m] reset=$X include=testdata/include.test cond=[if=$X then=[foo=x]]"); err != nil {
+		t.Error(err)
+	}
+	expected = `level=DEBUG msg=operator name=macro value="$M Y=m" depth=1
+level=DEBUG msg=macro symbols=[$M] arguments=1
+level=DEBUG msg=operator name=reset value=$X depth=1
+level=DEBUG msg=reset symbol=$X
+level=DEBUG msg=operator name=include value=testdata/include.test depth=1
+level=DEBUG msg=include file=testdata/include.test
+level=DEBUG msg=operator name=-- value="this is for testing the include operator" depth=2
+level=DEBUG msg=operator name=cond value="if=$X then=[foo=x]" depth=1
+level=DEBUG msg=cond branch=none
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected trace: %s", buf.String())
+	}
+}
+
+func TestOperatorTraceSecret(t *testing.T) {
+	os.Setenv("ARGS_TEST_PASS", "hunter2 zz")
+	defer os.Unsetenv("ARGS_TEST_PASS")
+	a := getParser()
+	var buf bytes.Buffer
+	a.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+	a.SetTrace(true)
+	foo := ""
+	a.Def("foo", &foo)
+	if err := a.Parse("import=[$ARGS_TEST_PASS secret] switch=[$ARGS_TEST_PASS case=[[hunter2 zz] [foo=x]]]"); err != nil {
+		t.Fatal(err)
+	}
+	expected := `level=DEBUG msg=operator name=import value="$ARGS_TEST_PASS secret" depth=1
+level=DEBUG msg=import variable=ARGS_TEST_PASS found=true
+level=DEBUG msg=operator name=switch value="$ARGS_TEST_PASS case=[[hunter2 zz] [foo=x]]" depth=1
+level=DEBUG msg=switch subject=$ARGS_TEST_PASS case=***
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected trace: %s", buf.String())
+	}
+}
+
 func TestOperatorImport(t *testing.T) {
 	a := args.NewParser()
 	err := a.Parse("import=foo")
@@ -538,3 +713,757 @@ func TestOperatorMacroErrors(t *testing.T) {
 		t.Error(err.Error())
 	}
 }
+
+func TestOperatorIncludeINI(t *testing.T) {
+	a := getParser()
+	usr := ""
+	pw := ""
+	name := ""
+	a.Def("usr", &usr)
+	a.Def("pw", &pw)
+	a.Def("name", &name)
+	if err := matchResult(
+		a.Parse("include=[testdata/ini.test ini keys=[name db.user=usr db.password=$PASS cache.user=$CUSER]] pw=$[PASS]"),
+		func() error {
+			if usr != "dbuser" || pw != "!=.sesam569" || name != "legacy" {
+				return fmt.Errorf(`unexpected results: usr="%s" pw="%s" name="%s"`, usr, pw, name)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorIncludeINISections(t *testing.T) {
+	a := getParser()
+	cache := map[string]string{}
+	a.Def("cache", &cache)
+	if err := matchResult(
+		a.Parse("include=[testdata/ini.test ini sections=[cache]]"),
+		func() error {
+			expected := map[string]string{"user": "cacheuser", "password": "cachepass", "ttl": "60"}
+			if fmt.Sprint(cache) != fmt.Sprint(expected) {
+				return fmt.Errorf(`unexpected result: %v`, cache)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/ini.test ini sections=[db=nonesuch]]"),
+		`include: section "db": "nonesuch" is not a parameter with a map target`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/ini.test sections=[db=cache]]"),
+		`include: specify sections only with ini`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorIncludeNamedGroups(t *testing.T) {
+	a := getParser()
+	usr := ""
+	pw := ""
+	motd := ""
+	a.Def("usr", &usr)
+	a.Def("pw", &pw)
+	a.Def("motd", &motd).Opt()
+	if err := matchResult(
+		a.Parse(`include=[testdata/pairs.test extractor=[(\s)(?P<key>\w+)=(?P<value>[^;\s]+);] keys=[user=usr password=pw] all]`),
+		func() error {
+			if usr != "u652" || pw != "!=.sesam570" {
+				return fmt.Errorf(`unexpected results: usr="%s" pw="%s"`, usr, pw)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchResult(
+		a.Parse(`include=[testdata/pairs.test extractor=[(?s)(?P<key>\w+)="(?P<value>.*?)"] keys=[motd] whole]`),
+		func() error {
+			if motd != "first line\nsecond line" {
+				return fmt.Errorf(`unexpected result: motd="%s"`, motd)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse(`include=[testdata/pairs.test extractor=[(\w+)=(\S+)(;)] keys=[user]]`),
+		`include: extractor "(\w+)=(\S+)(;)" must have 2 capture groups or groups named key and value`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorIncludeFS(t *testing.T) {
+	a := getParser()
+	foo := ""
+	bar := ""
+	usr := ""
+	a.Def("foo", &foo)
+	a.Def("bar", &bar)
+	a.Def("usr", &usr)
+	override := fstest.MapFS{
+		"conf/main.args": {Data: []byte("foo=[override] include=[defaults.args]")},
+	}
+	embedded := fstest.MapFS{
+		"conf/main.args":     {Data: []byte("foo=[embedded]")},
+		"conf/defaults.args": {Data: []byte("bar=[default] include=[db.conf keys=[user=usr]]")},
+		"conf/db.conf":       {Data: []byte("user = u653\n")},
+		"conf/cycle.args":    {Data: []byte("include=[./cycle.args]")},
+	}
+	a.SetFS(override, embedded)
+	if err := matchResult(
+		a.Parse("include=[conf/main.args]"),
+		func() error {
+			if foo != "override" || bar != "default" || usr != "u653" {
+				return fmt.Errorf(`unexpected results: foo="%s" bar="%s" usr="%s"`, foo, bar, usr)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("include=[conf/cycle.args]"),
+		`cyclical include dependency with file "conf/cycle.args"`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("include=[conf/missing.args]"),
+		`include: open conf/missing.args: file does not exist`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorIncludeRelative(t *testing.T) {
+	a := getParser()
+	foo := ""
+	bar := ""
+	a.Def("foo", &foo)
+	a.Def("bar", &bar)
+	if err := matchResult(
+		a.Parse("include=[testdata/sub/relative.test]"),
+		func() error {
+			if foo != "value of foo" || bar != "value of bar" {
+				return fmt.Errorf(`unexpected results: foo="%s" bar="%s"`, foo, bar)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+
+	a.SetRelativeIncludes(false)
+	err := a.Parse("include=[testdata/sub/relative.test]")
+	if err == nil || !strings.HasSuffix(err.Error(), "/include.test: no such file or directory") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestOperatorIncludePath(t *testing.T) {
+	a := getParser()
+	foo := ""
+	bar := ""
+	a.Def("foo", &foo)
+	a.Def("bar", &bar)
+	a.AddIncludePath("testdata/sub", "testdata")
+	if err := matchResult(
+		a.Parse("include=[include.test]"),
+		func() error {
+			if foo != "value of foo" || bar != "value of bar" {
+				return fmt.Errorf(`unexpected results: foo="%s" bar="%s"`, foo, bar)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorIncludeOptional(t *testing.T) {
+	a := getParser()
+	foo := ""
+	a.Def("foo", &foo)
+	if err := matchResult(
+		a.Parse("foo=bar include=[testdata/missing.test optional]"),
+		func() error {
+			if foo != "bar" {
+				return fmt.Errorf(`unexpected result: foo="%s"`, foo)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorIncludeGlob(t *testing.T) {
+	a := getParser()
+	foo := ""
+	bar := ""
+	a.Def("foo", &foo)
+	a.Def("bar", &bar)
+	if err := matchResult(
+		a.Parse("include=[testdata/conf.d/*.test]"),
+		func() error {
+			if foo != "first" || bar != "second" {
+				return fmt.Errorf(`unexpected results: foo="%s" bar="%s"`, foo, bar)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/conf.d/*.none]"),
+		`include: no file matches "testdata/conf.d/*.none"`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchResult(
+		a.Parse("include=[testdata/conf.d/*.none optional]"),
+		func() error { return nil }); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorIncludeGlobDirectories(t *testing.T) {
+	a := getParser()
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/su*]"),
+		`include: no file matches "testdata/su*"`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	foo := ""
+	a.Def("foo", &foo)
+	a.SetFS(fstest.MapFS{
+		"conf/a.args":   {Data: []byte("foo=a")},
+		"conf/b.args/c": {Data: []byte("foo=c")},
+	})
+	if err := matchResult(
+		a.Parse("include=[conf/*.args]"),
+		func() error {
+			if foo != "a" {
+				return fmt.Errorf(`unexpected result: foo="%s"`, foo)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorCondExpressions(t *testing.T) {
+	tests := []struct {
+		cond     string
+		expected bool
+	}{
+		{`$ENV == [prod]`, true},
+		{`$ENV==[prod]`, true},
+		{`$ENV != [prod]`, false},
+		{`$[ENV] == [prod]`, true},
+		{`$UNDEF == [prod]`, false},
+		{`$UNDEF != [prod]`, true},
+		{`not $[DEBUG]`, false},
+		{`$[DEBUG] == false`, true},
+		{`not $[UNDEF]`, true},
+		{`verbose and $ENV`, true},
+		{`verbose and $UNDEF`, false},
+		{`$UNDEF or verbose`, true},
+		{`not (verbose or $UNDEF)`, false},
+		{`$ENV =~ [^p(ro|re)d]`, true},
+		{`$COUNT > 9`, true},
+		{`$COUNT <= 9`, false},
+		{`level >= 2.5 and level < 3`, true},
+		{`[two words] == [two words]`, true},
+		{`$ENV == [dev] or $ENV == [staging]`, false},
+		{`verbose or nonesuch`, true},
+		{`$UNDEF and $COUNT > nonesuch`, false},
+		{`not verbose and [x] =~ [(]`, false},
+		{`level == 2.75 and $COUNT >= +10.0`, true},
+	}
+	for _, test := range tests {
+		a := getParser()
+		foo := ""
+		verbose := false
+		level := 0.0
+		a.Def("foo", &foo).Opt()
+		a.Def("verbose", &verbose).Opt()
+		a.Def("level", &level).Opt()
+		input := "$ENV=prod $DEBUG=false $COUNT=10 verbose level=2.75 " +
+			"cond=[if=[" + test.cond + "] then=[foo=yes] else=[foo=no]]"
+		if err := matchResult(
+			a.Parse(input),
+			func() error {
+				if (foo == "yes") != test.expected {
+					return fmt.Errorf(`"%s": unexpected result: %s`, test.cond, foo)
+				}
+				return nil
+			}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+}
+
+func TestOperatorCondSymbolValues(t *testing.T) {
+	tests := []struct {
+		cond     string
+		expected bool
+	}{
+		{`$[ENV] == [a b]`, true},
+		{`$ENV == [a b]`, true},
+		{`$[ENV] == [a]`, false},
+		{`$[OP] == [x or true]`, true},
+		{`$[OP] == [x]`, false},
+		{`$[NEG] and $NEG`, true},
+		{`$[TOKEN] == [abc!=x]`, true},
+		{`$[ENV:-c] == [a b] and $[UNDEF:-c] == [c]`, true},
+	}
+	for _, test := range tests {
+		a := getParser()
+		foo := ""
+		a.Def("foo", &foo).Opt()
+		input := "$ENV=[a b] $OP=[x or true] $NEG=false $TOKEN=[abc!=x] " +
+			"cond=[if=[" + test.cond + "] then=[foo=yes] else=[foo=no]]"
+		if err := matchResult(
+			a.Parse(input),
+			func() error {
+				if (foo == "yes") != test.expected {
+					return fmt.Errorf(`"%s": unexpected result: %s`, test.cond, foo)
+				}
+				return nil
+			}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+
+	a := getParser()
+	if err := matchErrorMessage(a.Parse("cond=[if=false then=[] elif=[nonesuch] then=[]]"), `cond/elif: parameter "nonesuch" not defined`); err != nil {
+		t.Error(err.Error())
+	}
+	// a literal must be quoted, even if there is no parameter with this name
+	if err := matchErrorMessage(a.Parse("$ENV=dev cond=[if=[$ENV == dev] then=[]]"), `cond/if: parameter "dev" not defined`); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(a.Parse("cond=[if=[false or nonesuch] then=[]]"), `cond/if: parameter "nonesuch" not defined`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorCondElif(t *testing.T) {
+	foo := ""
+	for env, expected := range map[string]string{"dev": "1", "staging": "2", "prod": "3", "local": "4"} {
+		a := getParser()
+		a.Def("foo", &foo)
+		if err := matchResult(
+			a.Parse("$ENV="+env+" cond=[if=[$ENV == [dev]] then=[foo=1] elif=[$ENV == [staging]] then=[foo=2] elif=[$ENV == [prod]] then=[foo=3] else=[foo=4]]"),
+			func() error {
+				if foo != expected {
+					return fmt.Errorf(`%s: unexpected result: %s`, env, foo)
+				}
+				return nil
+			}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+	a := getParser()
+	a.Def("foo", &foo)
+	if err := matchErrorMessage(
+		a.Parse("cond=[if=[$ENV == [dev]] then=[foo=1] elif=[$ENV == [staging]]]"),
+		`cond: 1 then specified but 2 expected`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse("$ENV=dev cond=[if=[$ENV > 1] then=[foo=1]]"),
+		`cond/if: "dev" is not a number`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorSwitch(t *testing.T) {
+	input := `switch=[$ENV
+		case=[dev [foo=1]]
+		case=[staging [foo=2]]
+		case=[[prod] [foo=3 $X=y]]
+		default=[foo=0]
+	]`
+	for env, expected := range map[string]string{"dev": "1", "staging": "2", "prod": "3", "local": "0"} {
+		a := getParser()
+		foo := ""
+		a.Def("foo", &foo)
+		if err := matchResult(
+			a.Parse("$ENV="+env+" "+input),
+			func() error {
+				if foo != expected {
+					return fmt.Errorf(`%s: unexpected result: %s`, env, foo)
+				}
+				return nil
+			}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+
+	a := getParser()
+	foo := ""
+	a.Def("foo", &foo).Opt()
+	if err := matchResult(
+		a.Parse(`switch=[$UNDEF case=[[] [foo=1]]]`),
+		func() error {
+			if foo != "" {
+				return fmt.Errorf(`unexpected result: %s`, foo)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+
+	a = getParser()
+	level := 0
+	a.Def("foo", &foo)
+	a.Def("level", &level)
+	if err := matchResult(
+		a.Parse(`level=2 switch=[level case=[1 [foo=one]] case=[2 [foo=two]]]`),
+		func() error {
+			if foo != "two" {
+				return fmt.Errorf(`unexpected result: %s`, foo)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorSwitchSymbolValues(t *testing.T) {
+	a := getParser()
+	foo := ""
+	a.Def("foo", &foo)
+	if err := matchResult(
+		a.Parse(`$V=[a b] $E=x $C=x switch=[$E case=[y [foo=y]] case=[$[C] [foo=$[V]]]]`),
+		func() error {
+			if foo != "a b" {
+				return fmt.Errorf(`unexpected result: "%s"`, foo)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorSwitchErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{`switch=[bar case=[1 [foo=1]]]`, `switch: parameter "bar" not defined`},
+		{`switch=[foo case=[1]]`, `switch/case: value and block expected in "1"`},
+		{`switch=[foo case=[1 [foo=1] [foo=2]]]`, `switch/case: value and block expected in "1 [foo=1] [foo=2]"`},
+		{`switch=[foo case=[1 = 2]]`, `switch/case: "=" unexpected in "1 = 2"`},
+	}
+	for _, test := range tests {
+		a := getParser()
+		foo := ""
+		a.Def("foo", &foo).Opt()
+		if err := matchErrorMessage(a.Parse(test.input), test.msg); err != nil {
+			t.Error(err.Error())
+		}
+	}
+}
+
+func TestOperatorMacroArguments(t *testing.T) {
+	a := getParser()
+	var servers []string
+	last := ""
+	a.Def("server", &servers)
+	a.Def("last", &last).Verbatim()
+	if err := matchResult(
+		a.Parse(`
+			$host=[$[name].example.com]
+			$server=[server=[$[host]:$[port]]]
+			macro=[$server name=web port=8080]
+			macro=[$server port=5432 name=db]
+			$name=global
+			macro=[$server name=[$[name]-2] port=1]
+			last=[$[host] $[port]]`),
+		func() error {
+			expected := "[web.example.com:8080 db.example.com:5432 global-2.example.com:1]"
+			if fmt.Sprint(servers) != expected {
+				return fmt.Errorf(`unexpected result: %v`, servers)
+			}
+			if last != "global.example.com $[port]" {
+				return fmt.Errorf(`unexpected result: %s`, last)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorMacroShadowedGlobal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// references to symbols defined before the macro are substituted
+		{`$host=x $m=[backend=$[host]] macro=[$m host=a] macro=[$m host=b]`, "[x x]"},
+		// arguments take precedence over symbols defined after the macro
+		{`$m=[backend=$[host]] $host=x macro=[$m host=a] macro=[$m host=b]`, "[a b]"},
+	}
+	for _, test := range tests {
+		a := getParser()
+		var backends []string
+		a.Def("backend", &backends)
+		if err := matchResult(a.Parse(test.input), func() error {
+			if fmt.Sprint(backends) != test.expected {
+				return fmt.Errorf("%s: unexpected result: %v", test.input, backends)
+			}
+			return nil
+		}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+}
+
+func TestOperatorMacroArgumentErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{`macro=[$m a+b=1]`, `macro: "a+b" cannot be used as a name because it includes the character '+'`},
+		{`macro=[$m []=1]`, `macro: argument name missing`},
+		{`macro=[$m x=1 =1]`, `macro: at "$m x=1 =": "=" unexpected`},
+		{`macro=[$m a=]`, `macro: at "$m a=": premature end of input`},
+	}
+	for _, test := range tests {
+		a := getParser()
+		if err := matchErrorMessage(a.Parse("$m=[] "+test.input), test.msg); err != nil {
+			t.Error(err.Error())
+		}
+	}
+}
+
+func TestOperatorForeach(t *testing.T) {
+	a := getParser()
+	var backends []string
+	a.Def("backend", &backends)
+	if err := matchResult(
+		a.Parse(`
+			$port=80
+			foreach=[var=$host in=[a [b c]] in=d do=[backend=[$[host]:$[port]]]]
+			foreach=[var=$host in=[e, f,g] split=[\s*,\s*] do=[backend=$[host]]]
+			foreach=[var=$host in=[h i] do=[
+				foreach=[var=$p in=[1 2] do=[backend=[$[host]:$[p]]]]
+			]]`),
+		func() error {
+			expected := "[a:80 b c:80 d:80 e f g h:1 h:2 i:1 i:2]"
+			if fmt.Sprint(backends) != expected {
+				return fmt.Errorf(`unexpected result: %v`, backends)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorForeachSymbolValues(t *testing.T) {
+	a := getParser()
+	var backends []string
+	a.Def("backend", &backends)
+	if err := matchResult(
+		a.Parse(`
+			$V=[a b] $S=[c d] $L=[e,f] $host=x
+			foreach=[var=$x in=[1] do=[backend=$[V]]]
+			foreach=[var=$x in=$[S] do=[backend=$[x]]]
+			foreach=[var=$x in=$[L] split=[,] do=[backend=$[x]]]
+			foreach=[var=$host in=[g] do=[backend=$[host]]]
+			backend=$[host]`),
+		func() error {
+			expected := `["a b" "c d" "e" "f" "g" "x"]`
+			if fmt.Sprintf("%q", backends) != expected {
+				return fmt.Errorf(`unexpected result: %v`, backends)
+			}
+			return nil
+		}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorForeachErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{`foreach=[var=host in=a do=[]]`, `foreach: "host": symbol prefix missing ($)`},
+		{`foreach=[var=$h in=a split=[(] do=[]]`, `foreach: compilation of split expression "(" failed: error parsing regexp: missing closing ): ` + "`(`"},
+		{`foreach=[var=$h in=[a = b] do=[]]`, `foreach/in: "=" unexpected in "a = b"`},
+		{`foreach=[var=$h in=[a b] do=[foo=$[h]]]`, `foreach: parsing for value "a" failed: parameter not defined: "foo"`},
+		{`backend=$[h] foreach=[var=$h in=a do=[]]`, `cannot resolve value in "backend = $[h]"`},
+	}
+	for _, test := range tests {
+		a := getParser()
+		var backends []string
+		a.Def("backend", &backends)
+		if err := matchErrorMessage(a.Parse(test.input), test.msg); err != nil {
+			t.Error(err.Error())
+		}
+	}
+}
+
+func TestOperatorScopedSymbols(t *testing.T) {
+	tests := []struct {
+		scoped   bool
+		input    string
+		expected string
+	}{
+		{false, `include=testdata/scoped.test $tmp=main foo=[$[tmp] $[result]]`, "helper from helper"},
+		{true, `include=testdata/scoped.test $tmp=main foo=[$[tmp] $[result]]`, "main from helper"},
+		{true, `$tmp=main include=testdata/scoped.test foo=[$[tmp] $[result]]`, "main from main"},
+		{true, `$m=[$tmp=macro] macro=[$m] $tmp=main foo=$[tmp]`, "main"},
+		{true, `$m=[$tmp=macro export=$tmp] macro=[$m] $tmp=main foo=$[tmp]`, "macro"},
+		{true, `cond=[if=true then=[$tmp=cond]] $tmp=main foo=$[tmp]`, "main"},
+		{true, `foreach=[var=$x in=[1] do=[$tmp=loop]] $tmp=main foo=$[tmp]`, "main"},
+		{false, `foreach=[var=$x in=[1] do=[$tmp=loop]] $tmp=main foo=$[tmp]`, "loop"},
+		{true, `cond=[if=true then=[cond=[if=true then=[$tmp=cond export=$tmp]]]] $tmp=main foo=$[tmp]`, "cond"},
+		{true, `switch=[$X default=[$tmp=switch]] $tmp=main foo=$[tmp]`, "main"},
+		{true, `foreach=[var=$x in=[a b] do=[$tmp=$[x]]] $tmp=main foo=$[tmp]`, "main"},
+		{false, `foreach=[var=$x in=[a b] do=[$tmp=$[x]]] $tmp=main foo=$[tmp]`, "a"},
+		{false, `$m=[export=$x] macro=[$m x=1] foo=$[x]`, "1"},
+	}
+	for _, test := range tests {
+		a := getParser()
+		a.SetScopedSymbols(test.scoped)
+		foo := ""
+		a.Def("foo", &foo)
+		if err := matchResult(
+			a.Parse(test.input),
+			func() error {
+				if foo != test.expected {
+					return fmt.Errorf(`%s: unexpected result: %s`, test.input, foo)
+				}
+				return nil
+			}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+	a := getParser()
+	if err := matchErrorMessage(a.Parse(`export=[$undef]`), `export: symbol "$undef" undefined`); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(a.Parse(`export=[undef]`), `export: "undef": symbol prefix missing ($)`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorSecret(t *testing.T) {
+	a := getParser()
+	var buf bytes.Buffer
+	a.SetDumpWriter(&buf)
+	password := ""
+	a.Def("password", &password)
+	os.Setenv("ARGS_TEST_SECRET", "sesam")
+	defer os.Unsetenv("ARGS_TEST_SECRET")
+	input := "import=[$ARGS_TEST_SECRET secret] " +
+		"include=[testdata/pairs.test extractor=[(\\s)(?P<key>\\w+)=(?P<value>[^;\\s]+);] keys=[user=$USER password] all secret] " +
+		"$P=[x$[ARGS_TEST_SECRET]] " +
+		"dump=[password $USER $P $ARGS_TEST_SECRET]"
+	if err := a.Parse(input); err != nil {
+		t.Fatal(err)
+	}
+	expected := "password ***\n$USER U ***\n$P U ***\n$ARGS_TEST_SECRET R ***\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output of dump: %s", buf.String())
+	}
+	if password != "!=.sesam570" {
+		t.Errorf("unexpected value of password: %s", password)
+	}
+
+	var n int
+	a = getParser()
+	a.Def("n", &n)
+	os.Setenv("ARGS_TEST_SECRET", "sesam")
+	if err := matchErrorMessage(a.Parse("import=[$ARGS_TEST_SECRET secret] n=$[ARGS_TEST_SECRET]"), `Parse error on n: strconv.ParseInt: parsing "***": invalid syntax`); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(a.Parse("include=[testdata/pairs.test secret]"), "include: specify secret only with keys or sections parameter"); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorClear(t *testing.T) {
+	a := getParser()
+	paths := []string{"/usr"}
+	m := map[string]int{"a": 1}
+	n := 0
+	a.Def("path", &paths).Aka("p")
+	a.Def("map", &m)
+	a.Def("n", &n).Opt()
+	if err := a.Parse("path=/opt map=[b=2] clear=[p map] path=/bin map=[c=3]"); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(paths) != "[/bin]" || fmt.Sprint(m) != "map[c:3]" {
+		t.Errorf("unexpected values: %v %v", paths, m)
+	}
+	if err := matchErrorMessage(a.Parse("clear=[path n]"), `clear: parameter "n" is neither a slice nor a map`); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(a.Parse("clear=[x]"), `clear: parameter "x" not defined`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorSecretWords(t *testing.T) {
+	os.Setenv("ARGS_TEST_PASS", "se sam")
+	defer os.Unsetenv("ARGS_TEST_PASS")
+	a := getParser()
+	n := []int{}
+	a.Def("n", &n)
+	imports := "import=[$ARGS_TEST_PASS secret] "
+	// words of a secret are masked only when the input includes the secret
+	if err := matchErrorMessage(a.Parse(imports+"sam=1"), `parameter not defined: "sam"`); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(a.Parse(imports+"n=$[ARGS_TEST_PASS]"), `Parse error on n: strconv.ParseInt: parsing "***": invalid syntax`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOperatorSecretErrors(t *testing.T) {
+	os.Setenv("ARGS_TEST_PASS", "se sam")
+	os.Setenv("ARGS_TEST_TOKEN", "abc!=x")
+	defer os.Unsetenv("ARGS_TEST_PASS")
+	defer os.Unsetenv("ARGS_TEST_TOKEN")
+	imports := "import=[$ARGS_TEST_PASS $ARGS_TEST_TOKEN secret] "
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`$[ARGS_TEST_PASS]=1`, `parameter not defined: "***"`},
+		{`cond=[if=[$[ARGS_TEST_TOKEN] > 3] then=[]]`, `cond/if: "***" is not a number`},
+		{`cond=[if=[true] then=[$[ARGS_TEST_PASS]=1]]`, `parameter not defined: "***"`},
+		{`switch=[x case=[[] [$[ARGS_TEST_PASS]=1]]]`, `parameter not defined: "***"`},
+		{`include=[testdata/$[ARGS_TEST_PASS]]`, ""},
+	}
+	for _, test := range tests {
+		a := getParser()
+		x := ""
+		a.Def("x", &x).Opt()
+		err := a.Parse(imports + test.input)
+		if err != nil && strings.Contains(err.Error(), "sam") {
+			t.Errorf("%s: secret disclosed: %v", test.input, err)
+			continue
+		}
+		if len(test.expected) == 0 {
+			// message depends on the working directory
+			if err == nil || !strings.HasPrefix(err.Error(), "include: open") {
+				t.Errorf("%s: unexpected error: %v", test.input, err)
+			}
+			continue
+		}
+		if e := matchErrorMessage(err, test.expected); e != nil {
+			t.Errorf("%s: %v", test.input, e)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"runtime"
 )
 
 // Param methods specify optional details of parameter definitions. A Param is
@@ -21,10 +22,28 @@ type Param struct {
 	limit    int    // limit for number of values (array: exact, slice: max unless 0, scalar: 0 for opt)
 	count    int    // actual number of values seen
 	verbatim bool
+	secret   bool   // value masked in output
+	env      string // environment variable taking the value if not set
+	replace  bool   // a new specification replaces previous values
+	layered  bool   // a new layer replaces the values of earlier layers
+	layer    int    // layer of the last value seen
+	counter  bool   // a standalone name increments the value
+	negation string // synonym setting the inverted value, if any
+	onSet    func(value string) error
 	target   interface{}
 	scan     func(value string, target interface{}) error
 	splitter *regexp.Regexp
 	doc      []string
+	groups   []*paramGroup // conditional definitions
+	inactive bool          // defined by a group no longer selected, not verified
+}
+
+// paramGroup is a group of parameters defined when a parameter takes a value.
+type paramGroup struct {
+	value   string
+	define  func(*Parser)
+	defined bool
+	params  []*Param // parameters defined by the group
 }
 
 // Aka sets alias as a synonym for the parameter name.  Panics if alias is
@@ -52,6 +71,112 @@ func (p *Param) Opt() *Param {
 	return p
 }
 
+// Counter indicates that the parameter counts its standalone occurrences. Each
+// time the parameter name is specified without a value, the value of the
+// target is incremented by 1, so that "v v v" sets a verbosity level of 3. A
+// value can still be specified explicitly. A counter is optional. Panics if
+// the target is not an integer.
+func (p *Param) Counter() *Param {
+	switch reflValue(p.target).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		panic(fmt.Errorf(`parameter "%s" cannot be a counter because its target of type %v is not an integer`, p.name, reflect.TypeOf(p.target)))
+	}
+	p.counter = true
+	p.limit = 0
+	return p
+}
+
+// Negatable adds the synonym "no-" followed by the parameter name, which sets
+// the inverted value. The standalone name "no-verbose" sets the target of
+// "verbose" to false, and "no-verbose=false" sets it to true. Panics if the
+// target is not a bool or if the synonym is already used.
+func (p *Param) Negatable() *Param {
+	if reflValue(p.target).Kind() != reflect.Bool {
+		panic(fmt.Errorf(`parameter "%s" cannot be negatable because its target of type %v is not a bool`, p.name, reflect.TypeOf(p.target)))
+	}
+	p.negation = "no-" + p.name
+	return p.Aka(p.negation)
+}
+
+// Secret indicates that the parameter value must not be disclosed. The value is
+// replaced with *** in dump output, in the documentation printed by PrintDoc,
+// and in error messages. A parameter also becomes secret when it takes a value
+// including the value of a secret symbol.
+func (p *Param) Secret() *Param {
+	p.secret = true
+	return p
+}
+
+// Env binds the parameter to an environment variable. When the input does not
+// set the parameter, it takes its value from the variable, if it exists, and
+// else keeps its default value. The value is taken literally and scanned like
+// a value specified in the input. Panics if name is empty.
+func (p *Param) Env(name string) *Param {
+	if len(name) == 0 {
+		panic(fmt.Errorf(`environment variable name for parameter "%s" is empty`, p.name))
+	}
+	p.env = name
+	return p
+}
+
+// LayerReplace indicates that a layer setting the parameter replaces all values
+// set by earlier layers, instead of adding to them (see Parser.ParseSources).
+// Panics if the target is not a slice.
+func (p *Param) LayerReplace() *Param {
+	if reflValue(p.target).Kind() != reflect.Slice {
+		panic(fmt.Errorf(`cannot replace values of "%s" by layer (only slice parameters can)`, p.name))
+	}
+	p.layered = true
+	return p
+}
+
+// Replace indicates that each specification of the parameter replaces all
+// values previously set, including default values, instead of adding to them.
+// Panics if the target is neither a slice nor a map, or if the parameter is
+// anonymous, because each standalone value is a separate specification.
+func (p *Param) Replace() *Param {
+	k := reflValue(p.target).Kind()
+	if k != reflect.Slice && k != reflect.Map {
+		panic(fmt.Errorf(`cannot replace values of "%s" (only slice and map parameters can)`, p.name))
+	}
+	if len(p.name) == 0 {
+		panic(fmt.Errorf(`cannot replace values of the anonymous parameter (each standalone value is a specification)`))
+	}
+	p.replace = true
+	return p
+}
+
+// OnSet sets a function called each time the parameter is set, after the
+// value has been converted and assigned to the target. The function takes the
+// value as specified, after symbol substitution. An error returned by the
+// function is reported like a conversion error. When a single entry of a map
+// is set, by a key of the anonymous map or by a key of an INI section taken
+// with include, the value is the key and the value joined by the separator.
+// OnSet is useful for parameters triggering immediate actions, like printing
+// help or defining additional parameters.
+func (p *Param) OnSet(f func(value string) error) *Param {
+	p.onSet = f
+	return p
+}
+
+// When sets a function defining a group of parameters when the parameter takes
+// the value specified. The function is called with the parser at most once,
+// when the value is set and before any OnSet function is called. The
+// parameters it defines can be specified in the input following the value, but
+// not before. A panic in the function, for example caused by an invalid
+// definition, is reported as a parse error. PrintDoc also calls the function,
+// with another parser, to document the group, unless the group has already
+// been defined, and prints a panic in the function as an error of the group.
+// Therefore the function should only define parameters. When the parameter
+// later takes another value, the parameters of the group remain defined but are
+// not verified: they can be omitted even if they are mandatory.
+func (p *Param) When(value string, define func(*Parser)) *Param {
+	p.groups = append(p.groups, &paramGroup{value: value, define: define})
+	return p
+}
+
 // Verbatim indicates that the parameter value can contain unresolved symbol
 // references. Only parameters with a target taking strings can be specified as
 // verbatim. Panics if the target points to a non-string.
@@ -121,6 +246,15 @@ func (p *Param) Split(regex string) *Param {
 func (p *Param) parseValues(values []string) error {
 	var err error
 	v := reflValue(p.target)
+	if p.layer != p.parser.layer {
+		p.layer = p.parser.layer
+		if p.layered && p.count > 0 {
+			p.clear()
+		}
+	}
+	if p.replace {
+		p.clear()
+	}
 	switch v.Kind() {
 	case reflect.Array:
 		err = p.parseArrayValues(values)
@@ -134,6 +268,9 @@ func (p *Param) parseValues(values []string) error {
 		p.count++
 	}
 	if err != nil {
+		if p.secret {
+			err = maskError(err, values...)
+		}
 		err = decorate(err, p.name)
 	}
 	return err
@@ -223,6 +360,76 @@ func (p *Param) parseMapValues(values []string) error {
 	return err
 }
 
+// notify defines the conditional groups selected by value, deactivates the
+// parameters of groups no longer selected, and then calls the OnSet function
+// of the parameter, if any.
+func (p *Param) notify(value string) error {
+	err := recovered(func() error {
+		for _, g := range p.groups {
+			selected := false
+			for _, v := range p.split(value) {
+				if v == g.value {
+					selected = true
+					break
+				}
+			}
+			if selected && !g.defined {
+				g.defined = true
+				n := len(p.parser.seq)
+				g.define(p.parser)
+				for _, name := range p.parser.seq[n:] {
+					g.params = append(g.params, p.parser.params[name])
+				}
+			}
+			for _, q := range g.params {
+				q.inactive = !selected
+			}
+		}
+		if p.onSet != nil {
+			return p.onSet(value)
+		}
+		return nil
+	})
+	if err != nil {
+		if p.secret {
+			err = maskError(err, value)
+		}
+		err = decorate(err, p.name)
+	}
+	return err
+}
+
+// recovered calls f and converts a panic with an error, like a panic of
+// Parser.Def, into a returned error. Runtime errors are not recovered.
+func recovered(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if _, isRuntime := r.(runtime.Error); !ok || isRuntime {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	return f()
+}
+
+// clear removes all values of a parameter with a slice or map target. It
+// returns false if the target is neither a slice nor a map.
+func (p *Param) clear() bool {
+	v := reflValue(p.target)
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 0, v.Cap()))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+	default:
+		return false
+	}
+	p.count = 0
+	return true
+}
+
 // split splits value around a splitter regular expression. It returns the input
 // if the parameter has no splitter.
 func (p *Param) split(value string) []string {
@@ -1,6 +1,13 @@
 package args_test
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jpvetterli/args"
+)
 
 func TestParamDuplicate(t *testing.T) {
 	a := getParser()
@@ -61,3 +68,292 @@ func TestParamOperator2(t *testing.T) {
 	i := 1
 	a.Def("include", &i)
 }
+
+func TestParamSecret(t *testing.T) {
+	a := getParser()
+	password := "sesam"
+	var pin int
+	a.Def("password", &password).Opt().Secret()
+	a.Def("pin", &pin).Secret()
+	b := bytes.Buffer{}
+	a.PrintDoc(&b)
+	if strings.Contains(b.String(), "sesam") || !strings.Contains(b.String(), "(default: ***)") {
+		t.Errorf("PrintDoc discloses a secret default value: %s", b.String())
+	}
+	if err := matchErrorMessage(a.Parse("pin=x1234"), `Parse error on pin: strconv.ParseInt: parsing "***": invalid syntax`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestParamEnv(t *testing.T) {
+	a := getParser()
+	defer panicHandler(`environment variable name for parameter "x" is empty`, t)
+	x := 0
+	a.Def("x", &x).Env("")
+}
+
+func TestParamReplace(t *testing.T) {
+	a := getParser()
+	paths := []string{"/usr", "/lib"}
+	var tags []string
+	m := map[string]int{"a": 1}
+	a.Def("path", &paths).Replace()
+	a.Def("tag", &tags).Split(",").Replace()
+	a.Def("map", &m).Replace()
+	if err := a.Parse("path=/opt path=/bin tag=[x,y,z] tag=[u,v] map=[b=2 c=3] map=[d=4]"); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != "/bin" || len(tags) != 2 || tags[1] != "v" || len(m) != 1 || m["d"] != 4 {
+		t.Errorf("unexpected values: %v %v %v", paths, tags, m)
+	}
+}
+
+func TestParamReplacePanic(t *testing.T) {
+	a := getParser()
+	defer panicHandler(`cannot replace values of "x" (only slice and map parameters can)`, t)
+	var x [2]int
+	a.Def("x", &x).Replace()
+}
+
+func TestParamReplaceAnonymousPanic(t *testing.T) {
+	a := getParser()
+	defer panicHandler(`cannot replace values of the anonymous parameter (each standalone value is a specification)`, t)
+	var s []string
+	a.Def("", &s).Replace()
+}
+
+func TestParamCounterNegatable(t *testing.T) {
+	a := getParser()
+	var v int
+	var q uint8
+	color := true
+	a.Def("v", &v).Counter()
+	a.Def("q", &q).Counter()
+	a.Def("color", &color).Negatable()
+	if err := a.Parse("v v q v no-color"); err != nil {
+		t.Fatal(err)
+	}
+	if v != 3 || q != 1 || color {
+		t.Errorf("unexpected values: %d %d %t", v, q, color)
+	}
+	if err := a.Parse("v=10 v no-color=false"); err != nil {
+		t.Fatal(err)
+	}
+	if v != 11 || !color {
+		t.Errorf("unexpected values: %d %t", v, color)
+	}
+	if err := a.Parse("color no-color color"); err != nil {
+		t.Fatal(err)
+	}
+	if !color {
+		t.Errorf("unexpected value: %t", color)
+	}
+	if err := matchErrorMessage(a.Parse("no-color=maybe"), `Parse error on color: strconv.ParseBool: parsing "maybe": invalid syntax`); err != nil {
+		t.Error(err.Error())
+	}
+
+	b := bytes.Buffer{}
+	a.PrintDoc(&b)
+	expected := `the command takes these parameters:
+  v        type: int, optional (default: 11), counter
+  q        type: uint8, optional (default: 1), counter
+  color, no-color
+           type: bool, negatable
+`
+	if b.String() != expected {
+		t.Errorf("PrintDoc output does not match: %s", b.String())
+	}
+}
+
+func TestParamCounterPanic(t *testing.T) {
+	a := getParser()
+	defer panicHandler(`parameter "v" cannot be a counter because its target of type *string is not an integer`, t)
+	v := ""
+	a.Def("v", &v).Counter()
+}
+
+func TestParamNegatablePanic(t *testing.T) {
+	a := getParser()
+	defer panicHandler(`synonym "no-x" clashes with an existing parameter name or synonym`, t)
+	x, y := false, false
+	a.Def("no-x", &y)
+	a.Def("x", &x).Negatable()
+}
+
+func TestParamOnSet(t *testing.T) {
+	a := getParser()
+	var seen []string
+	help := false
+	plugin, level := "", 0
+	a.Def("help", &help).Opt().OnSet(func(value string) error {
+		seen = append(seen, "help="+value)
+		return nil
+	})
+	a.Def("plugin", &plugin).Opt().OnSet(func(value string) error {
+		if value != "levels" {
+			return fmt.Errorf(`plugin "%s" not found`, value)
+		}
+		a.Def("level", &level)
+		return nil
+	})
+	if err := a.Parse("help plugin=levels level=3"); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(seen) != "[help=true]" || level != 3 {
+		t.Errorf("unexpected results: %v %d", seen, level)
+	}
+	if err := matchErrorMessage(a.Parse("plugin=colors"), `Parse error on plugin: plugin "colors" not found`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestParamWhenOverridden(t *testing.T) {
+	driver, host, file := "", "", ""
+	def := func() *args.Parser {
+		a := getParser()
+		a.Def("driver", &driver).
+			When("postgres", func(a *args.Parser) { a.Def("host", &host) }).
+			When("sqlite", func(a *args.Parser) { a.Def("file", &file) })
+		return a
+	}
+	if err := def().Parse("driver=postgres driver=sqlite file=x"); err != nil {
+		t.Error(err)
+	}
+	if err := matchErrorMessage(def().Parse("driver=sqlite file=x driver=postgres"), `Parse error on host: mandatory parameter not set`); err != nil {
+		t.Error(err.Error())
+	}
+	a := def()
+	a.AddSource(
+		args.StringSource("defaults", "driver=postgres"),
+		args.ArgsSource([]string{"driver=sqlite", "file=y"}),
+	)
+	if err := a.ParseSources(); err != nil {
+		t.Error(err)
+	}
+	if driver != "sqlite" || file != "y" {
+		t.Errorf("unexpected values: %s %s", driver, file)
+	}
+}
+
+func TestParamWhenPrintDocPanic(t *testing.T) {
+	a := getParser()
+	mode, host, port := "", "", ""
+	a.Def("mode", &mode).When("remote", func(a *args.Parser) {
+		a.Def("host", &host)
+		a.Def("$port", &port)
+	})
+	b := bytes.Buffer{}
+	a.PrintDoc(&b)
+	expected := `the command takes these parameters:
+  mode     type: string
+
+parameters when mode=remote:
+  host     type: string
+  error: "$port" cannot be used as a name because it includes the character '$'
+`
+	if b.String() != expected {
+		t.Errorf("PrintDoc output does not match: %s", b.String())
+	}
+}
+
+func TestParamOnSetMaps(t *testing.T) {
+	a := getParser()
+	var seen []string
+	anon := map[string]string{}
+	cache := map[string]string{}
+	a.Def("", &anon).Opt().OnSet(func(value string) error {
+		seen = append(seen, value)
+		return nil
+	})
+	a.Def("cache", &cache).OnSet(func(value string) error {
+		seen = append(seen, "cache "+value)
+		return nil
+	})
+	if err := a.Parse("x=1 include=[testdata/ini.test ini sections=[cache]] y=2"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[x=1 cache user=cacheuser cache password=cachepass cache ttl=60 y=2]"
+	if fmt.Sprint(seen) != expected {
+		t.Errorf("unexpected results: %v", seen)
+	}
+}
+
+func TestParamOnSetPanic(t *testing.T) {
+	a := getParser()
+	x, y := "", ""
+	a.Def("x", &x).OnSet(func(value string) error {
+		a.Def("x", &y)
+		return nil
+	})
+	if err := matchErrorMessage(
+		a.Parse("x=1"),
+		`Parse error on x: parameter "x" already defined`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestParamWhen(t *testing.T) {
+	a := getParser()
+	driver, host, file := "", "", ""
+	port := 5432
+	postgres := func(a *args.Parser) {
+		a.Def("host", &host).Doc("database host")
+		a.Def("port", &port).Opt()
+	}
+	a.Def("driver", &driver).
+		When("postgres", postgres).
+		When("sqlite", func(a *args.Parser) { a.Def("file", &file) })
+
+	b := bytes.Buffer{}
+	a.PrintDoc(&b)
+	expected := `the command takes these parameters:
+  driver   type: string
+
+parameters when driver=postgres:
+  host     database host
+           type: string
+  port     type: int, optional (default: 5432)
+
+parameters when driver=sqlite:
+  file     type: string
+`
+	if b.String() != expected {
+		t.Errorf("PrintDoc output does not match: %s", b.String())
+	}
+
+	if err := matchErrorMessage(a.Parse("host=db driver=postgres"), `parameter not defined: "host"`); err != nil {
+		t.Error(err.Error())
+	}
+	a = getParser()
+	a.Def("driver", &driver).When("postgres", postgres)
+	if err := matchErrorMessage(a.Parse("driver=postgres"), `Parse error on host: mandatory parameter not set`); err != nil {
+		t.Error(err.Error())
+	}
+	a = getParser()
+	a.Def("driver", &driver).When("postgres", postgres)
+	if err := a.Parse("driver=postgres host=db port=5433 driver=postgres"); err != nil {
+		t.Fatal(err)
+	}
+	if host != "db" || port != 5433 {
+		t.Errorf("unexpected values: %s %d", host, port)
+	}
+
+	b.Reset()
+	a.PrintDoc(&b)
+	expected = `the command takes these parameters:
+  driver   type: string
+  host     database host
+           type: string
+  port     type: int, optional (default: 5433)
+`
+	if b.String() != expected {
+		t.Errorf("PrintDoc output does not match: %s", b.String())
+	}
+
+	a = getParser()
+	a.Def("driver", &driver).When("postgres", func(a *args.Parser) { a.Def("driver", &host) })
+	if err := matchErrorMessage(a.Parse("driver=postgres"), `Parse error on driver: parameter "driver" already defined`); err != nil {
+		t.Error(err.Error())
+	}
+}
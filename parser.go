@@ -3,7 +3,11 @@ package args
 import (
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"os"
 	"reflect"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -17,7 +21,33 @@ type Parser struct {
 	doc     []string
 	targets map[interface{}]bool // duplicate detection
 	symbols symtab
-	cycle   map[string]bool // include cycle detector
+	cycle   includeStack   // include cycle detector
+	fs      []fs.FS        // file systems for include, none means the OS
+	cwd     bool           // resolve relative include names against working directory
+	incPath []string       // include search path
+	usage   usage          // resources used by the current parse
+	dump    io.Writer      // output of dump, nil means standard error
+	logger  *slog.Logger   // logger for dump and trace, nil means none
+	tracing bool           // log operator invocations
+	envPre  string         // prefix of environment variables bound to parameters
+	sources []Source       // layers parsed by ParseSources
+	after   []func() error // functions added with AfterParse
+	layer   int            // current layer, 0 unless parsing sources
+}
+
+// limitError reports that a limit has been exceeded. Operators pass it on
+// without decoration to keep the message short.
+type limitError string
+
+func (e limitError) Error() string {
+	return string(e)
+}
+
+// usage keeps track of resources subject to limits.
+type usage struct {
+	depth    int // operator nesting depth
+	input    int // bytes of input
+	includes int // number of included files
 }
 
 // CustomParser returns a new Parser with a specific configuration. Because the
@@ -32,13 +62,20 @@ func CustomParser(configuration *Config) *Parser {
 		doc:     make([]string, 0),
 		targets: make(map[interface{}]bool),
 		symbols: newSymtab(copy),
-		cycle:   make(map[string]bool),
 	}
 }
 
 // SubParser returns a new Parser configured like the parser specified.
 func SubParser(parser *Parser) *Parser {
-	return CustomParser(parser.config)
+	sub := CustomParser(parser.config)
+	sub.fs = parser.fs
+	sub.cwd = parser.cwd
+	sub.incPath = parser.incPath
+	sub.symbols.scoped = parser.symbols.scoped
+	sub.dump = parser.dump
+	sub.logger = parser.logger
+	sub.tracing = parser.tracing
+	return sub
 }
 
 // NewParser returns a new Parser with a default configuration.
@@ -46,6 +83,144 @@ func NewParser() *Parser {
 	return CustomParser(NewConfig())
 }
 
+// SetFS sets one or more file systems used by the include operator instead of
+// the file system of the operating system. When a file does not exist in the
+// first file system, it is taken from the second one, and so on. This allows,
+// for example, files on disk to override defaults embedded in the program with
+// go:embed. Names of included files must then be valid file system paths as
+// described in io/fs. Use os.DirFS to include a directory of the operating
+// system in the sequence. Calling SetFS without arguments reverts to the file
+// system of the operating system.
+func (a *Parser) SetFS(fsys ...fs.FS) {
+	a.fs = fsys
+}
+
+// SetRelativeIncludes specifies how relative file names in included files are
+// resolved by the include operator. By default, they are resolved against the
+// directory of the including file. When relative is false, they are resolved
+// against the working directory of the process (or the root of the file systems
+// configured with SetFS), which was the behavior of earlier versions. File
+// names in the top-level input are always resolved against the working
+// directory.
+func (a *Parser) SetRelativeIncludes(relative bool) {
+	a.cwd = !relative
+}
+
+// AddIncludePath adds directories to the include path. When the include
+// operator cannot find a file with a relative name, it tries to find it in the
+// directories of the include path, in sequence.
+func (a *Parser) AddIncludePath(dir ...string) {
+	a.incPath = append(a.incPath, dir...)
+}
+
+// SetScopedSymbols specifies whether symbols defined while parsing an included
+// file, a macro, the input selected by cond or switch, or the input of one
+// iteration of foreach are local. By default, all symbols are global. Local
+// symbols are discarded when parsing of the input ends. They can be made global
+// with the export operator. Symbol references are resolved in the innermost
+// scope first, and then in enclosing scopes. The "first wins" principle applies
+// to all visible symbols.
+func (a *Parser) SetScopedSymbols(scoped bool) {
+	a.symbols.scoped = scoped
+}
+
+// SetEnvPrefix binds all named parameters to environment variables (see
+// Param.Env). The name of the variable is the prefix followed by the parameter
+// name in upper case, with any character other than a letter or a digit
+// replaced with an underscore. For example, with prefix "TOOL_" the parameter
+// "max-size" is bound to TOOL_MAX_SIZE. A name specified with Param.Env takes
+// precedence. An empty prefix removes the binding.
+func (a *Parser) SetEnvPrefix(prefix string) {
+	a.envPre = prefix
+}
+
+// SetDumpWriter sets the writer used by the dump operator. Setting nil reverts
+// to the default, standard error.
+func (a *Parser) SetDumpWriter(w io.Writer) {
+	a.dump = w
+}
+
+// SetLogger sets a structured logger. When a logger is set, the dump operator
+// logs records at the info level instead of printing them, unless a writer
+// has been set with SetDumpWriter, and trace events are logged with it.
+// Setting nil removes the logger.
+func (a *Parser) SetLogger(logger *slog.Logger) {
+	a.logger = logger
+}
+
+// SetTrace turns tracing on or off. When tracing is on, each operator
+// invocation is logged at the debug level, followed by events describing
+// what the operator does, like the branch taken by cond, files included,
+// macros expanded, environment variables imported, and symbols reset. Events
+// are logged with the logger set with SetLogger, or with the default logger
+// of the slog package.
+func (a *Parser) SetTrace(trace bool) {
+	a.tracing = trace
+}
+
+// trace logs a trace event if tracing is on.
+func (a *Parser) trace(msg string, args ...interface{}) {
+	if !a.tracing {
+		return
+	}
+	logger := a.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Debug(msg, args...)
+}
+
+// SetSymbol defines a symbol with a value, unless the symbol is already defined
+// ("first wins" principle). It returns true if the symbol has been defined.
+// The name is specified without symbol prefix. Unlike the value of a symbol
+// defined in the input, the value is taken literally and is not subject to
+// symbol substitution. It is an error if the name is invalid or if the number
+// of symbols would exceed the limit.
+func (a *Parser) SetSymbol(name, value string) (bool, error) {
+	if len(name) == 0 {
+		return false, fmt.Errorf("symbol name missing")
+	}
+	if err := validate(name); err != nil {
+		return false, err
+	}
+	return a.symbols.define(name, &symval{resolved: true, s: value})
+}
+
+// Symbol returns the value of a symbol, and true if the value is resolved. The
+// name is specified without symbol prefix. A value not resolved yet is resolved
+// if possible. It is an error if the symbol is undefined or if resolving the
+// value fails.
+func (a *Parser) Symbol(name string) (string, bool, error) {
+	if isCall(name) {
+		return "", false, fmt.Errorf(`symbol "%s" undefined`, name)
+	}
+	sv, err := a.symbols.get(name)
+	if err != nil {
+		return "", false, err
+	}
+	if sv == nil {
+		return "", false, fmt.Errorf(`symbol "%s" undefined`, name)
+	}
+	return sv.s, sv.resolved, nil
+}
+
+// Symbols returns the names of all visible symbols, sorted, and without symbol
+// prefix. Like dump, it includes local symbols when called while parsing, for
+// example from a function set with Param.OnSet.
+func (a *Parser) Symbols() []string {
+	return a.symbols.names()
+}
+
+// DeleteSymbol removes a symbol from the symbol table, like the reset operator.
+// It returns true if the symbol was defined.
+func (a *Parser) DeleteSymbol(name string) bool {
+	if sv, _ := a.symbols.lookup(name); sv == nil {
+		return false
+	}
+	a.symbols.remove(name)
+	return true
+}
+
 // Def defines a parameter with a name and a target to take one or more values.
 // It returns a Param which can be used to optionally configure various details.
 // This is designed to allow chaining of methods, so that a complete parameter
@@ -88,7 +263,7 @@ func (a *Parser) Def(name string, target interface{}) *Param {
 	if err := validate(name); err != nil {
 		panic(err)
 	}
-	if a.operator(name) != nil {
+	if _, ok := a.config.opDict[name]; ok {
 		panic(fmt.Errorf(`parameter name "%s" is the name of an operator`, name))
 	}
 	p := Param{parser: a, name: name, target: target}
@@ -113,11 +288,66 @@ func (a *Parser) Def(name string, target interface{}) *Param {
 // result is nil unless there is an error.  The input syntax is explained in the
 // package documentation.
 func (a *Parser) ParseBytes(b []byte) error {
+	if a.usage.depth == 0 {
+		a.usage = usage{}
+	}
 	err := a.parseBytes(b)
 	if err != nil {
 		return err
 	}
-	return a.verify()
+	if err := a.environment(true); err != nil {
+		return err
+	}
+	return a.finish()
+}
+
+// AfterParse adds a function called after parsing with ParseBytes (or any
+// function calling it) or ParseSources, when all parameters have been verified
+// successfully. Functions are called in the sequence they were added and the
+// first error is returned as is. AfterParse is useful for checking
+// dependencies between parameters.
+func (a *Parser) AfterParse(f func() error) {
+	a.after = append(a.after, f)
+}
+
+// finish verifies the result of parsing and calls the AfterParse functions.
+func (a *Parser) finish() error {
+	if err := a.verify(); err != nil {
+		return err
+	}
+	for _, f := range a.after {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddSource adds sources to the layers parsed by ParseSources.
+func (a *Parser) AddSource(src ...Source) {
+	a.sources = append(a.sources, src...)
+}
+
+// ParseSources parses all sources in the sequence they were added, typically
+// from built-in defaults to the command line, and then verifies the result like
+// ParseBytes. Each source is a layer with a higher precedence than the layers
+// before it. A parameter taking a single value takes the value of the last
+// layer setting it ("last wins"). A parameter with a slice target accumulates
+// the values of all layers, unless it is defined with Param.LayerReplace.
+// Symbols keep the "first wins" principle across layers.
+func (a *Parser) ParseSources() error {
+	a.usage = usage{}
+	defer func() { a.layer = 0 }()
+	for i, s := range a.sources {
+		a.layer = i + 1
+		if err := a.parseSource(s); err != nil {
+			return err
+		}
+	}
+	if err := a.environment(true); err != nil {
+		return err
+	}
+	return a.finish()
 }
 
 // Parse calls ParseBytes with s converted to a byte slice.
@@ -130,6 +360,14 @@ func (a *Parser) ParseStrings(s []string) error {
 	return a.Parse(strings.Join(s, " "))
 }
 
+// ParseFragment parses s as if it had been specified in place of an operator.
+// Unlike Parse, it does not verify that all mandatory parameters have been
+// set, because the remaining input still has to be parsed. It is intended for
+// operators added by programs (see Config.AddOperator).
+func (a *Parser) ParseFragment(s string) error {
+	return a.parse(s)
+}
+
 // Doc sets lines of help text for the command as a whole.
 func (a *Parser) Doc(s ...string) {
 	a.doc = s
@@ -188,10 +426,20 @@ func (a *Parser) PrintDoc(w io.Writer, s ...interface{}) {
 		fmt.Fprintf(w, "Usage: %v parameters...\n\nParameters:\n", s)
 	}
 
+	a.printParams(w)
+}
+
+// printParams prints the documentation of parameters, followed by the
+// parameters of conditional groups not yet defined.
+func (a *Parser) printParams(w io.Writer) {
 	syn := buildSynonyms(a)
 	for _, n := range a.seq {
 		p := a.params[n]
 		value := reflValue(p.target)
+		var shown interface{} = value
+		if p.secret {
+			shown = mask
+		}
 		details := ""
 		typ := value.Type()
 		switch value.Kind() {
@@ -207,7 +455,7 @@ func (a *Parser) PrintDoc(w io.Writer, s ...interface{}) {
 				details += ", any number of values"
 			}
 			if value.Len() > 0 {
-				details += fmt.Sprintf(" (default: %v)", value)
+				details += fmt.Sprintf(" (default: %v)", shown)
 			}
 		case reflect.Array:
 			typ = typ.Elem()
@@ -219,14 +467,23 @@ func (a *Parser) PrintDoc(w io.Writer, s ...interface{}) {
 		case reflect.Map:
 			details = ""
 			if value.Len() > 0 {
-				details += fmt.Sprintf(" (default: %v)", value)
+				details += fmt.Sprintf(" (default: %v)", shown)
 			}
 		default:
 			// scalar
 			if p.limit == 0 {
-				details = fmt.Sprintf(", optional (default: %v)", value)
+				details = fmt.Sprintf(", optional (default: %v)", shown)
 			}
 		}
+		if p.counter {
+			details += ", counter"
+		}
+		if len(p.negation) > 0 {
+			details += ", negatable"
+		}
+		if k := a.envName(p); len(k) > 0 {
+			details += ", env: " + k
+		}
 		if n == p.name {
 			info := fmt.Sprintf("type: %s%s", typ, details)
 			n = syn[n]
@@ -250,11 +507,33 @@ func (a *Parser) PrintDoc(w io.Writer, s ...interface{}) {
 			}
 		}
 	}
+	for _, n := range a.seq {
+		p := a.params[n]
+		if n != p.name {
+			continue
+		}
+		for _, g := range p.groups {
+			if g.defined {
+				continue
+			}
+			sub := SubParser(a)
+			err := recovered(func() error {
+				g.define(sub)
+				return nil
+			})
+			fmt.Fprintf(w, "\nparameters when %s%c%s:\n", n, a.config.GetSpecial(SpecSeparator), g.value)
+			sub.printParams(w)
+			if err != nil {
+				fmt.Fprintf(w, "  error: %v\n", err)
+			}
+		}
+	}
 }
 
 // PrintConfig uses a Writer to print the parser configuration. This consists of
-// the special characters configured in the parser. Nothing is printed when no
-// parameter is defined.
+// the special characters and the operators configured in the parser, including
+// operators added by the program. Nothing is printed when no parameter is
+// defined.
 func (a *Parser) PrintConfig(w io.Writer) {
 	if len(a.seq) > 0 {
 		fmt.Fprintf(w, "\nSpecial characters:\n")
@@ -268,13 +547,20 @@ func (a *Parser) PrintConfig(w io.Writer) {
 			reverse[v] = n
 		}
 		text := make(map[opConstant]string, len(a.config.opDict))
-		text[OpCond] = "conditional parsing (if, then, else)"
-		text[OpDump] = "print parameters and symbols on standard error (comment)"
+		text[OpClear] = "remove all values of slice and map parameters"
+		text[OpCond] = "conditional parsing (if, then, elif, else)"
+		text[OpDump] = "print parameters and symbols (comment, format, all)"
+		text[OpExport] = "make local symbols global"
+		text[OpForeach] = "repeat parsing for a list of values (var, in, split, do)"
 		text[OpImport] = "import environment variables as symbols"
-		text[OpInclude] = "include a file or extract name-values (keys, extractor)"
+		text[OpInclude] = "include a file or extract name-values (optional, keys, extractor, all, whole, ini, sections, secret)"
 		text[OpMacro] = "expand symbols"
 		text[OpReset] = "remove symbols"
 		text[OpSkip] = "do not parse the value (= comment out)"
+		text[OpSwitch] = "multi-way branching (case, default)"
+		for i, op := range a.config.opCustom {
+			text[opCustom+opConstant(i)] = op.doc
+		}
 
 		print := func(name, doc string) {
 			if len(name) > 8 {
@@ -284,13 +570,9 @@ func (a *Parser) PrintConfig(w io.Writer) {
 				fmt.Fprintf(w, "  %-8s %s\n", name, doc)
 			}
 		}
-		print(reverse[OpCond], text[OpCond])
-		print(reverse[OpDump], text[OpDump])
-		print(reverse[OpImport], text[OpImport])
-		print(reverse[OpInclude], text[OpInclude])
-		print(reverse[OpMacro], text[OpMacro])
-		print(reverse[OpReset], text[OpReset])
-		print(reverse[OpSkip], text[OpSkip])
+		for _, op := range a.config.operators() {
+			print(reverse[op], text[op])
+		}
 	}
 }
 
@@ -301,8 +583,22 @@ func (a *Parser) parse(s string) error {
 	return a.parseBytes([]byte(s))
 }
 
+// parseScoped parses s in a new scope when symbols are scoped, else it
+// parses s normally.
+func (a *Parser) parseScoped(s string) error {
+	if a.symbols.scoped {
+		a.symbols.pushScope(make(map[string]*symval))
+		defer a.symbols.popScope()
+	}
+	return a.parse(s)
+}
+
 // parseBytes parses b. It can be used recursively.
 func (a *Parser) parseBytes(b []byte) error {
+	a.usage.input += len(b)
+	if max := a.config.limits[LimitInput]; max > 0 && a.usage.input > max {
+		return limitError(fmt.Sprintf("input size exceeds limit of %d bytes", max))
+	}
 	nvp := newNameValParser(a, b)
 	var name, value *symval
 	var err error
@@ -321,7 +617,7 @@ func (a *Parser) parseBytes(b []byte) error {
 			// standalone name or value
 			if a.isStandaloneBoolParameter(value) {
 				// standalone name
-				name, value = value, &symval{resolved: true, s: "true"}
+				name, value = value, &symval{resolved: true, s: a.standaloneValue(value.s)}
 			} else {
 				// standalone value
 				if _, ok := a.params[""]; !ok {
@@ -336,14 +632,25 @@ func (a *Parser) parseBytes(b []byte) error {
 
 		operator := a.operator(name.s)
 		if operator != nil {
-			err := operator.handle(value.s)
+			if max := a.config.limits[LimitDepth]; max > 0 && a.usage.depth >= max {
+				return limitError(fmt.Sprintf(`operator "%s": nesting depth exceeds limit of %d`, name.s, max))
+			}
+			if value.secret {
+				a.trace("operator", "name", name.s, "value", mask, "depth", a.usage.depth+1)
+			} else {
+				a.trace("operator", "name", name.s, "value", value.s, "depth", a.usage.depth+1)
+			}
+			a.usage.depth++
+			err := operator.Handle(value.s)
+			a.usage.depth--
 			if err != nil {
-				return err
+				// operators resolve symbols themselves
+				return a.symbols.maskSecrets(err, value.secret)
 			}
 		} else {
 			err := a.setValue(name, value)
 			if err != nil {
-				return err
+				return a.symbols.maskSecrets(err, value.secret)
 			}
 		}
 	}
@@ -353,12 +660,28 @@ func (a *Parser) parseBytes(b []byte) error {
 func (a *Parser) isStandaloneBoolParameter(value *symval) bool {
 	if value.resolved {
 		if p, ok := a.params[value.s]; ok {
-			return reflTakesBool(p.target)
+			return p.counter || reflTakesBool(p.target)
 		}
 	}
 	return false
 }
 
+// standaloneValue returns the value implied by the standalone name of a
+// parameter: the next count for a counter, else true.
+func (a *Parser) standaloneValue(name string) string {
+	p := a.params[name]
+	if p.counter {
+		v := reflValue(p.target)
+		switch v.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return strconv.FormatUint(v.Uint()+1, 10)
+		default:
+			return strconv.FormatInt(v.Int()+1, 10)
+		}
+	}
+	return "true"
+}
+
 // getAnonymousMapParameter returns *Param of anonymous map if defined, else nil
 func (a *Parser) getAnonymousMapParameter() *Param {
 	if p, ok := a.params[""]; ok {
@@ -376,26 +699,54 @@ func (a *Parser) setValue(name, value *symval) error {
 		return fmt.Errorf(`cannot resolve name in "%s %c %s"`, name.s, a.config.GetSpecial(SpecSeparator), value.s)
 	}
 
-	if !a.symbols.put(name.s, value.s) {
+	isSymbol, err := a.symbols.putSecret(name.s, value.s, value.secret)
+	if err != nil {
+		return err
+	}
+	if !isSymbol {
 		if p, ok := a.params[name.s]; ok {
+			p.secret = p.secret || value.secret
+			s := value.s
+			if p.secret {
+				s = mask
+			}
 
 			if !value.resolved {
 				if !p.verbatim {
 					if len(name.s) == 0 {
-						return fmt.Errorf(`cannot resolve standalone value "%s"`, value.s)
+						return fmt.Errorf(`cannot resolve standalone value "%s"`, s)
 					}
-					return fmt.Errorf(`cannot resolve value in "%s %c %s"`, name.s, a.config.GetSpecial(SpecSeparator), value.s)
+					return fmt.Errorf(`cannot resolve value in "%s %c %s"`, name.s, a.config.GetSpecial(SpecSeparator), s)
+				}
+			}
+
+			v := value.s
+			if len(p.negation) > 0 && name.s == p.negation {
+				b, err := strconv.ParseBool(v)
+				if err != nil {
+					return decorate(err, p.name)
 				}
+				v = strconv.FormatBool(!b)
 			}
 
-			err := p.parseValues(p.split(value.s))
+			err := p.parseValues(p.split(v))
 
 			if err != nil {
 				return err
 			}
+			if err := p.notify(v); err != nil {
+				return err
+			}
 		} else {
 			if p := a.getAnonymousMapParameter(); p != nil {
-				return convertKeyValue(name.s, value.s, p.target)
+				p.secret = p.secret || value.secret
+				if err := convertKeyValue(name.s, value.s, p.target); err != nil {
+					if p.secret {
+						return maskError(err, value.s)
+					}
+					return err
+				}
+				return p.notify(fmt.Sprintf("%s%c%s", name.s, a.config.GetSpecial(SpecSeparator), value.s))
 			}
 			return fmt.Errorf(`parameter not defined: "%s"`, name.s)
 		}
@@ -403,11 +754,54 @@ func (a *Parser) setValue(name, value *symval) error {
 	return nil
 }
 
+// environment sets parameters from the environment variables they are bound
+// to. As a fallback, it sets only parameters not set by the input.
+func (a *Parser) environment(fallback bool) error {
+	// parameters defined by conditional groups are appended to a.seq
+	for i := 0; i < len(a.seq); i++ {
+		n := a.seq[i]
+		p := a.params[n]
+		if n != p.name || fallback && p.count > 0 {
+			continue
+		}
+		k := a.envName(p)
+		if len(k) == 0 {
+			continue
+		}
+		v, ok := os.LookupEnv(k)
+		a.trace("environment", "parameter", n, "variable", k, "found", ok)
+		if ok {
+			err := p.parseValues(p.split(v))
+			if err == nil {
+				err = p.notify(v)
+			}
+			if err != nil {
+				return fmt.Errorf("%v (environment variable %s)", err, k)
+			}
+		}
+	}
+	return nil
+}
+
+// envName returns the name of the environment variable bound to p, or an
+// empty string.
+func (a *Parser) envName(p *Param) string {
+	if len(p.env) > 0 || len(a.envPre) == 0 || len(p.name) == 0 {
+		return p.env
+	}
+	return a.envPre + strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, p.name)
+}
+
 // verify verifies that omitted parameters can be omitted and that default
 // values of omitted parameters are valid.
 func (a *Parser) verify() error {
 	for n, p := range a.params {
-		if n == p.name {
+		if n == p.name && !p.inactive {
 			value := reflValue(p.target)
 			switch value.Kind() {
 			case reflect.Slice:
@@ -448,15 +842,43 @@ func (a *Parser) verify() error {
 
 // name-value parser manages the tokenizer and remembers one name read to far.
 type nameValParser struct {
-	t    tokenizer
-	name *symval // nil means next is a name
+	t        tokenizer
+	name     *symval           // nil means next is a name
+	deferred func(string) bool // true if value of name is used later
+	literal  func(string) bool // true if value of name is not substituted
 }
 
 // newNameValParser returns a new name-value parser
 func newNameValParser(p *Parser, input []byte) nameValParser {
 	tkz := newTokenizer(p.config, &p.symbols)
 	tkz.reset(input)
-	return nameValParser{t: *tkz}
+	return nameValParser{t: *tkz, deferred: p.deferred, literal: p.literal}
+}
+
+// deferred returns true if the value of name is not used immediately: the
+// value of a symbol, an operator, or a verbatim parameter.
+func (a *Parser) deferred(name string) bool {
+	if _, ok := a.config.opDict[name]; ok {
+		return true
+	}
+	if p, ok := a.params[name]; ok {
+		return p.verbatim
+	}
+	r := []rune(name)
+	prefix := a.config.GetSpecial(SpecSymbolPrefix)
+	return len(r) > 1 && r[0] == prefix && r[1] != prefix
+}
+
+// literal returns true if symbol references in the value of name are not
+// substituted: the values of cond, switch and foreach, whose conditions,
+// subjects and lists are evaluated with the values of symbols, and whose
+// blocks are substituted once, when parsed.
+func (a *Parser) literal(name string) bool {
+	op, ok := a.config.opDict[name]
+	if !ok || a.config.disabled[op] {
+		return false
+	}
+	return op == OpCond || op == OpSwitch || op == OpForeach
 }
 
 // next returns a name symval, a value symval, and an error. The name can be
@@ -505,7 +927,10 @@ func (nvp *nameValParser) next() (*symval, *symval, error) {
 
 	// after name and separator, expect value (string)
 
+	nvp.t.deferred = name.resolved && nvp.deferred(name.s)
+	nvp.t.literal = name.resolved && nvp.literal(name.s)
 	token, s, err = nvp.t.next()
+	nvp.t.deferred, nvp.t.literal = false, false
 	if token == tokenError {
 		return nil, nil, decorate(err, name.s)
 	}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -872,14 +873,18 @@ Special characters:
   \        escape
 
 Built-in operators:
-  cond     conditional parsing (if, then, else)
-  dump     print parameters and symbols on standard error (comment)
+  clear    remove all values of slice and map parameters
+  cond     conditional parsing (if, then, elif, else)
+  dump     print parameters and symbols (comment, format, all)
+  export   make local symbols global
+  foreach  repeat parsing for a list of values (var, in, split, do)
   import   import environment variables as symbols
-  include  include a file or extract name-values (keys, extractor)
+  include  include a file or extract name-values (optional, keys, extractor, all, whole, ini, sections, secret)
   macro    expand symbols
   zurücksetzen
            remove symbols
   --       do not parse the value (= comment out)
+  switch   multi-way branching (case, default)
 `
 	if b.String() != expected {
 		t.Errorf("PrintDoc output does not match")
@@ -1057,6 +1062,160 @@ func TestSubsBasic(t *testing.T) {
 	}
 }
 
+func TestSubsModifiers(t *testing.T) {
+	var testData = []struct {
+		input  string
+		expect string
+	}{
+		{"foo=$[a:-x]", "x"},
+		{"$a=b foo=$[a:-x]", "b"},
+		{"foo=[$[a:-x y]]", "x y"},
+		{"$d=z foo=$[a:-$[d]]", "z"},
+		{"foo=$[a:+x]", ""},
+		{"$a=b foo=$[a:+x $[a]]", "x b"},
+		{"$a=b foo=$[a:?]", "b"},
+		// definition and verbatim value keep reference to undefined symbol
+		{"$c=$[a:-x] $a=b foo=$[c]", "b"},
+		{"bar=$[a:-x] foo=$[a:-y]", "y"},
+		{"$m=[foo=$[port:-80]] macro=[$m]", "80"},
+		{"$m=[foo=$[port:-80]] macro=[$m port=8080]", "8080"},
+		{"cond=[if=[$[a:-x] == [x]] then=[foo=yes] else=[foo=no]]", "yes"},
+	}
+
+	for _, data := range testData {
+		a := getParser()
+		foo := ""
+		bar := ""
+		a.Def("foo", &foo).Opt()
+		a.Def("bar", &bar).Opt().Verbatim()
+		if err := matchResult(
+			a.Parse(data.input),
+			func() error {
+				if foo != data.expect {
+					return fmt.Errorf(`input: "%s" result: "%s" expect: "%s"`, data.input, foo, data.expect)
+				}
+				if len(bar) > 0 && bar != "$[a:-x]" {
+					return fmt.Errorf(`input: "%s" result: "%s" expect: "%s"`, data.input, bar, "$[a:-x]")
+				}
+				return nil
+			}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+
+	a := getParser()
+	foo := ""
+	a.Def("foo", &foo)
+	if err := matchErrorMessage(
+		a.Parse("foo=$[a:?please specify a]"),
+		`Parse error on foo: at "...ease specify a]": symbol "a" undefined: please specify a`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestSubsModifierSeparator(t *testing.T) {
+	var testData = []struct {
+		input  string
+		expect string
+	}{
+		{"foo:$[a|-x]", "x"},
+		{"$a:b foo:$[a|+x $[a]]", "x b"},
+		{"$c:$[a|-x] $a:b foo:$[c]", "b"},
+		{"cond:[if:[$[a|-x] == [x]] then:[foo:yes]]", "yes"},
+	}
+
+	newParser := func() *args.Parser {
+		c := args.NewConfig()
+		c.SetSpecial(args.SpecSeparator, ':')
+		c.SetModifier('|')
+		return args.CustomParser(c)
+	}
+	for _, data := range testData {
+		a := newParser()
+		foo := ""
+		a.Def("foo", &foo).Opt()
+		if err := matchResult(
+			a.Parse(data.input),
+			func() error {
+				if foo != data.expect {
+					return fmt.Errorf(`input: "%s" result: "%s" expect: "%s"`, data.input, foo, data.expect)
+				}
+				return nil
+			}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+
+	c := args.NewConfig()
+	c.SetSpecial(args.SpecSeparator, ':')
+	a := args.CustomParser(c)
+	foo := ""
+	a.Def("foo", &foo)
+	if err := matchErrorMessage(
+		a.Parse("foo:$[a:-x]"),
+		`Parse error on foo: at "foo:$[a:": character invalid in symbol: ':'`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestSubsFunctions(t *testing.T) {
+	var testData = []struct {
+		input  string
+		expect string
+	}{
+		{"$h=/home/User foo=$[upper h]", "/HOME/USER"},
+		{"$h=/home/User foo=[$[lower h]]", "/home/user"},
+		{"$s=[ a ] foo=[<$[trim s]>]", "<a>"},
+		{"$s=xxaxx foo=$[trim s x]", "a"},
+		{"$s=a-b-c foo=$[replace s - _]", "a_b_c"},
+		{"$s=a-b-c foo=$[replace s - [ + ]]", "a + b + c"},
+		{"$s=a-b $r=_ foo=$[replace s - $[r]]", "a_b"},
+		{"$p=/a/b/c.txt foo=$[basename p]", "c.txt"},
+		{"$p=/a/b/c.txt foo=$[dirname p]", "/a/b"},
+		{"$d=/a foo=$[join d b c.txt]", "/a/b/c.txt"},
+		{"$d=/a foo=$[join\td\nb]", "/a/b"},
+		{"$u=$[upper h] $h=x foo=$[u]", "X"},
+		{"$ENV=prod cond=[if=[$[upper ENV] == [PROD]] then=[foo=yes]]", "yes"},
+	}
+
+	for _, data := range testData {
+		a := getParser()
+		foo := ""
+		a.Def("foo", &foo).Opt()
+		if err := matchResult(
+			a.Parse(data.input),
+			func() error {
+				if foo != data.expect {
+					return fmt.Errorf(`input: "%s" result: "%s" expect: "%s"`, data.input, foo, data.expect)
+				}
+				return nil
+			}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+
+	var errorData = []struct {
+		input string
+		msg   string
+	}{
+		{"foo=$[upper h]", `cannot resolve value in "foo = $[upper h]"`},
+		{"$h=x foo=$[nosuch h]", `Parse error on foo: at "...foo=$[nosuch h]": error resolving "nosuch h": function "nosuch" not defined`},
+		{"$s=x foo=$[replace s a]", `Parse error on foo: at "...=$[replace s a]": error resolving "replace s a": function "replace": 1 argument specified but 2 expected`},
+		{"$s=x foo=$[upper s a]", `Parse error on foo: at "...oo=$[upper s a]": error resolving "upper s a": function "upper": 1 argument specified but 0 expected`},
+		{"$s=x foo=$[trim s a b]", `Parse error on foo: at "...o=$[trim s a b]": error resolving "trim s a b": function "trim": 2 arguments specified but 0 to 1 expected`},
+		{"$s=x foo=$[upper s=a]", `Parse error on foo: at "...oo=$[upper s=a]": error resolving "upper s=a": function "upper": "=" unexpected`},
+		{"$x=[$[upper x]] foo=$[x]", `Parse error on foo: cyclical symbol definition detected: "x"`},
+	}
+	for _, data := range errorData {
+		a := getParser()
+		foo := ""
+		a.Def("foo", &foo)
+		if err := matchErrorMessage(a.Parse(data.input), data.msg); err != nil {
+			t.Error(err.Error())
+		}
+	}
+}
+
 func TestSubsCycle(t *testing.T) {
 
 	var testData = []struct {
@@ -1329,3 +1488,194 @@ func captureStderr(f func() error) (result string, err error) {
 func getParser() *args.Parser {
 	return args.NewParser()
 }
+
+func TestLimitDepth(t *testing.T) {
+	a := getParser()
+	if err := matchErrorMessage(
+		a.Parse("$m=[macro=$m] macro=$m"),
+		`operator "macro": nesting depth exceeds limit of 100`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestLimitInput(t *testing.T) {
+	c := args.NewConfig()
+	c.SetLimit(args.LimitInput, 1000)
+	a := args.CustomParser(c)
+	foo := ""
+	a.Def("foo", &foo)
+	if err := matchErrorMessage(
+		a.Parse("$a=xxxxxxxx $b=[$[a]$[a]] $c=[$[b]$[b]] $d=[$[c]$[c]] $e=[$[d]$[d]] $f=[$[e]$[e]] $g=[$[f]$[f]] $h=[$[g]$[g]] foo=$[h]"),
+		`Parse error on $h: at "...]] $h=[$[g]$[g]": value exceeds limit of 1000 bytes after substitution of "g"`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	if err := matchErrorMessage(
+		a.Parse(strings.Repeat("foo=bar ", 200)),
+		`input size exceeds limit of 1000 bytes`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestLimitIncludesAndSymbols(t *testing.T) {
+	c := args.NewConfig()
+	c.SetLimit(args.LimitIncludes, 1)
+	c.SetLimit(args.LimitSymbols, 2)
+	a := args.CustomParser(c)
+	foo := ""
+	bar := ""
+	a.Def("foo", &foo)
+	a.Def("bar", &bar)
+	if err := matchErrorMessage(
+		a.Parse("include=[testdata/include.test] include=[testdata/include.test]"),
+		`include: "testdata/include.test": number of included files exceeds limit of 1`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+	// limit applies to each parse
+	if err := a.Parse("include=[testdata/include.test]"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := matchErrorMessage(
+		a.Parse("$a=1 $b=2 $a=3 $c=3"),
+		`cannot define "$c": number of symbols exceeds limit of 2`,
+	); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestSymbolAccess(t *testing.T) {
+	a := getParser()
+	foo := ""
+	a.Def("foo", &foo)
+	if ok, err := a.SetSymbol("X", "[literal] $Y"); !ok || err != nil {
+		t.Errorf("SetSymbol X failed: %v", err)
+	}
+	if ok, err := a.SetSymbol("X", "second"); ok || err != nil {
+		t.Errorf("SetSymbol X succeeded twice: %v", err)
+	}
+	if err := a.Parse("$X=input $Z=[z $[X]] $U=$[undef] foo=$[Z]"); err != nil {
+		t.Fatal(err)
+	}
+	if foo != "z [literal] $Y" {
+		t.Errorf("unexpected result: %s", foo)
+	}
+	for name, expected := range map[string]string{"X": "[literal] $Y", "Z": "z [literal] $Y"} {
+		v, resolved, err := a.Symbol(name)
+		if err != nil || !resolved || v != expected {
+			t.Errorf(`%s: unexpected result: "%s" %t %v`, name, v, resolved, err)
+		}
+	}
+	if v, resolved, err := a.Symbol("U"); err != nil || resolved || v != "$[undef]" {
+		t.Errorf(`U: unexpected result: "%s" %t %v`, v, resolved, err)
+	}
+	if err := matchErrorMessage(func() error { _, _, err := a.Symbol("undef"); return err }(), `symbol "undef" undefined`); err != nil {
+		t.Error(err.Error())
+	}
+	if s := fmt.Sprint(a.Symbols()); s != "[U X Z]" {
+		t.Errorf("unexpected symbols: %s", s)
+	}
+	if !a.DeleteSymbol("X") || a.DeleteSymbol("X") {
+		t.Error("DeleteSymbol X failed")
+	}
+	if s := fmt.Sprint(a.Symbols()); s != "[U Z]" {
+		t.Errorf("unexpected symbols: %s", s)
+	}
+}
+
+func TestSymbolAccessErrors(t *testing.T) {
+	c := args.NewConfig()
+	c.SetLimit(args.LimitSymbols, 1)
+	a := args.CustomParser(c)
+	_, err := a.SetSymbol("$X", "")
+	if err := matchErrorMessage(err, `"$X" cannot be used as a name because it includes the character '$'`); err != nil {
+		t.Error(err.Error())
+	}
+	if _, err := a.SetSymbol("X", "x"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.SetSymbol("Y", "y")
+	if err := matchErrorMessage(err, `cannot define "$Y": number of symbols exceeds limit of 1`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestEnvBinding(t *testing.T) {
+	os.Setenv("ARGS_TEST_PORT", "8080")
+	os.Setenv("ARGS_TEST_HOST", "example.org")
+	os.Setenv("ARGS_TEST_MAX_SIZE", "3")
+	os.Setenv("ARGS_TEST_TAGS", "a,b")
+	defer func() {
+		for _, k := range []string{"ARGS_TEST_PORT", "ARGS_TEST_HOST", "ARGS_TEST_MAX_SIZE", "ARGS_TEST_TAGS"} {
+			os.Unsetenv(k)
+		}
+	}()
+	a := getParser()
+	port, host, size, user := 80, "localhost", 1, "nobody"
+	var tags []string
+	a.Def("port", &port).Env("ARGS_TEST_PORT")
+	a.Def("host", &host).Opt().Env("ARGS_TEST_HOST")
+	a.Def("max-size", &size).Opt()
+	a.Def("user", &user).Opt()
+	a.Def("tags", &tags).Split(",")
+	a.SetEnvPrefix("ARGS_TEST_")
+	if err := a.Parse("host=example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if port != 8080 || host != "example.com" || size != 3 || user != "nobody" || fmt.Sprint(tags) != "[a b]" {
+		t.Errorf("unexpected values: %d %s %d %s %v", port, host, size, user, tags)
+	}
+
+	b := bytes.Buffer{}
+	a.PrintDoc(&b)
+	expected := `the command takes these parameters:
+  port     type: int, env: ARGS_TEST_PORT
+  host     type: string, optional (default: example.com), env: ARGS_TEST_HOST
+  max-size type: int, optional (default: 3), env: ARGS_TEST_MAX_SIZE
+  user     type: string, optional (default: nobody), env: ARGS_TEST_USER
+  tags     type: string, split: ,, any number of values (default: [a b]), env: ARGS_TEST_TAGS
+`
+	if b.String() != expected {
+		t.Errorf("PrintDoc output does not match: %s", b.String())
+	}
+
+	a = getParser()
+	a.Def("port", &port).Env("ARGS_TEST_PORT")
+	os.Setenv("ARGS_TEST_PORT", "http")
+	if err := matchErrorMessage(a.Parse(""), `Parse error on port: strconv.ParseInt: parsing "http": invalid syntax (environment variable ARGS_TEST_PORT)`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestAfterParse(t *testing.T) {
+	a := getParser()
+	min, max := 0, 10
+	a.Def("min", &min).Opt()
+	a.Def("max", &max).Opt()
+	calls := 0
+	a.AfterParse(func() error {
+		calls++
+		return nil
+	})
+	a.AfterParse(func() error {
+		if min > max {
+			return fmt.Errorf("min %d greater than max %d", min, max)
+		}
+		return nil
+	})
+	if err := a.Parse("min=5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := matchErrorMessage(a.Parse("min=20"), "min 20 greater than max 10"); err != nil {
+		t.Error(err.Error())
+	}
+	a.AddSource(args.StringSource("defaults", "max=30"))
+	if err := a.ParseSources(); err != nil {
+		t.Error(err)
+	}
+	if calls != 3 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
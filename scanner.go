@@ -14,14 +14,18 @@ type tokenizer struct {
 	reader    *bytes.Reader
 	resolver  resolver
 	resolved  bool
+	secret    bool // value includes the value of a secret symbol
 	stringBuf bytes.Buffer
 	symBuf    bytes.Buffer
 	stack     stack
+	deferred  bool // keep references to undefined symbols with modifiers
+	literal   bool // keep all symbol references without substitution
 }
 
 func (t *tokenizer) symval() *symval {
 	return &symval{
 		resolved: t.resolved,
+		secret:   t.secret,
 		s:        t.stringBuf.String(),
 	}
 }
@@ -97,6 +101,7 @@ func (t *tokenizer) reset(input []byte) {
 	t.reader.Reset(input)
 	t.stringBuf.Reset()
 	t.resolved = true
+	t.secret = false
 	t.symBuf.Reset()
 	t.stack = t.stack[:0]
 }
@@ -114,6 +119,7 @@ func (t *tokenizer) next() (scanToken, *symval, error) {
 	}
 	t.stringBuf.Reset()
 	t.resolved = true
+	t.secret = false
 	for {
 		tokType, tok, err := t.scan()
 		if tokType != tokenNone {
@@ -204,7 +210,12 @@ func (t *tokenizer) scan() (scanToken, *symval, error) {
 			return tokenString, t.symval(), nil
 		case tsBracket:
 			t.stringBuf.WriteRune(r)
-		case tsSymbol, tsPrefix:
+		case tsSymbol:
+			if t.symBuf.Len() > 0 {
+				return t.call(r)
+			}
+			return t.symbolCharacterError(r)
+		case tsPrefix:
 			return t.symbolCharacterError(r)
 		case tsEscape:
 			t.stack.pop()
@@ -259,6 +270,9 @@ func (t *tokenizer) scan() (scanToken, *symval, error) {
 			return t.symbolCharacterError(r)
 		case tsPrefix:
 			t.stack.pop()
+			if t.literal {
+				return t.literalReference()
+			}
 			t.stack.push(tsSymbol)
 		case tsEscape:
 			t.stack.pop()
@@ -297,7 +311,11 @@ func (t *tokenizer) scan() (scanToken, *symval, error) {
 				return t.genericError(fmt.Sprintf(`error resolving "%s": %v`, symbol, err))
 			}
 			if symval != nil {
+				t.secret = t.secret || symval.secret
 				t.stringBuf.WriteString(symval.s)
+				if max := t.config.limits[LimitInput]; max > 0 && t.stringBuf.Len() > max {
+					return t.genericError(fmt.Sprintf(`value exceeds limit of %d bytes after substitution of "%s"`, max, symbol))
+				}
 			} else {
 				t.stringBuf.WriteRune(t.config.GetSpecial(SpecSymbolPrefix))
 				t.stringBuf.WriteRune(t.config.GetSpecial(SpecOpenQuote))
@@ -342,6 +360,8 @@ func (t *tokenizer) scan() (scanToken, *symval, error) {
 		case tsSymbol:
 			if valid(r) {
 				t.symBuf.WriteRune(r)
+			} else if r == t.config.modifier && t.symBuf.Len() > 0 {
+				return t.modifier()
 			} else {
 				return t.symbolCharacterError(r)
 			}
@@ -363,3 +383,144 @@ func (t *tokenizer) scan() (scanToken, *symval, error) {
 
 	return tokenNone, nil, nil
 }
+
+// modifier handles a symbol reference with a modifier, after the separator. It
+// reads the modifier and the text up to the close quote matching the open
+// quote of the reference, resolves the symbol, and substitutes the reference.
+// The text is resolved only when used. When the tokenizer is deferred, a
+// reference to an undefined symbol is kept as is, as if it had no modifier.
+func (t *tokenizer) modifier() (scanToken, *symval, error) {
+	op, _, err := t.reader.ReadRune()
+	if err != nil {
+		return t.genericError("premature end of input")
+	}
+	if op != '-' && op != '?' && op != '+' {
+		return t.genericError(fmt.Sprintf("invalid modifier '%c%c' in symbol reference", t.config.modifier, op))
+	}
+	open := t.config.GetSpecial(SpecOpenQuote)
+	close := t.config.GetSpecial(SpecCloseQuote)
+	var text bytes.Buffer
+	if !t.rest(&text) {
+		return t.genericError("premature end of input")
+	}
+	t.reader.ReadRune() // close quote
+
+	t.stack.pop()
+	t.stack.pushIfEmpty(tsString)
+	symbol := t.symBuf.String()
+	t.symBuf.Reset()
+	symval, err := t.resolver.get(symbol)
+	if err != nil {
+		t.stack.push(tsError)
+		if _, ok := err.(cycleError); ok {
+			return tokenError, nil, err
+		}
+		return t.genericError(fmt.Sprintf(`error resolving "%s": %v`, symbol, err))
+	}
+
+	switch {
+	case symval == nil && t.deferred:
+		t.resolved = false
+		t.stringBuf.WriteRune(t.config.GetSpecial(SpecSymbolPrefix))
+		t.stringBuf.WriteRune(open)
+		t.stringBuf.WriteString(symbol)
+		t.stringBuf.WriteRune(t.config.modifier)
+		t.stringBuf.WriteRune(op)
+		t.stringBuf.Write(text.Bytes())
+		t.stringBuf.WriteRune(close)
+		return tokenNone, nil, nil
+	case symval == nil && op == '?':
+		if text.Len() == 0 {
+			return t.genericError(fmt.Sprintf(`symbol "%s" undefined`, symbol))
+		}
+		return t.genericError(fmt.Sprintf(`symbol "%s" undefined: %s`, symbol, text.String()))
+	case symval == nil && op == '+':
+		// substitute nothing
+	case symval != nil && op != '+':
+		if !symval.resolved {
+			t.resolved = false
+		}
+		t.secret = t.secret || symval.secret
+		t.stringBuf.WriteString(symval.s)
+	default:
+		// substitute the text, after resolving it
+		sub := newTokenizer(t.config, t.resolver)
+		sub.deferred = t.deferred
+		quoted := string(open) + text.String() + string(close)
+		sub.reset([]byte(quoted))
+		_, sv, err := sub.next()
+		if err != nil {
+			return t.genericError(fmt.Sprintf(`error resolving "%s": %v`, symbol, err))
+		}
+		if !sv.resolved {
+			t.resolved = false
+		}
+		t.secret = t.secret || sv.secret
+		t.stringBuf.WriteString(sv.s)
+	}
+	if max := t.config.limits[LimitInput]; max > 0 && t.stringBuf.Len() > max {
+		return t.genericError(fmt.Sprintf(`value exceeds limit of %d bytes after substitution of "%s"`, max, symbol))
+	}
+	return tokenNone, nil, nil
+}
+
+// literalReference copies a symbol reference without substituting it, after
+// the open quote of the reference.
+func (t *tokenizer) literalReference() (scanToken, *symval, error) {
+	var text bytes.Buffer
+	if !t.rest(&text) {
+		return t.genericError("premature end of input")
+	}
+	t.reader.ReadRune() // close quote
+	t.stack.pushIfEmpty(tsString)
+	t.resolved = false
+	t.stringBuf.WriteRune(t.config.GetSpecial(SpecSymbolPrefix))
+	t.stringBuf.WriteRune(t.config.GetSpecial(SpecOpenQuote))
+	t.stringBuf.Write(text.Bytes())
+	t.stringBuf.WriteRune(t.config.GetSpecial(SpecCloseQuote))
+	return tokenNone, nil, nil
+}
+
+// call handles a function call in a symbol reference, after the white space
+// following the function name. It reads the text up to the close quote
+// matching the open quote of the reference and resolves the call.
+func (t *tokenizer) call(space rune) (scanToken, *symval, error) {
+	var text bytes.Buffer
+	text.WriteString(t.symBuf.String())
+	text.WriteRune(space)
+	if !t.rest(&text) {
+		return t.genericError("premature end of input")
+	}
+	t.symBuf.Reset()
+	t.symBuf.Write(text.Bytes())
+	return t.scan() // not at end of input
+}
+
+// rest reads the remaining text of a symbol reference into buf, up to the close
+// quote matching the open quote of the reference, and unreads the close quote.
+// It returns false if the end of input is reached first.
+func (t *tokenizer) rest(buf *bytes.Buffer) bool {
+	open := t.config.GetSpecial(SpecOpenQuote)
+	close := t.config.GetSpecial(SpecCloseQuote)
+	escape := t.config.GetSpecial(SpecEscape)
+	for depth := 1; ; {
+		r, _, err := t.reader.ReadRune()
+		if err != nil {
+			return false
+		}
+		if r == escape {
+			buf.WriteRune(r)
+			if r, _, err = t.reader.ReadRune(); err != nil {
+				return false
+			}
+		} else if r == open {
+			depth++
+		} else if r == close {
+			if depth--; depth == 0 {
+				t.reader.UnreadRune()
+				return true
+			}
+		}
+		buf.WriteRune(r)
+	}
+}
@@ -78,7 +78,10 @@ var tokTestData = []struct {
 	{`foo = abc$[symbol]cba etc.`, []interface{}{"foo", tokenEqual, "abc$[symbol]cba", "etc."}},
 	{`foo = \ $[symbol]\]`, []interface{}{"foo", tokenEqual, " $[symbol]]"}},
 	{`foo = \$[symbol]`, []interface{}{"foo", tokenEqual, "$symbol"}},
-	{`foo = $[s mbol]`, []interface{}{"foo", tokenEqual, errors.New(`at "foo = $[s ": character invalid in symbol: ' '`)}},
+	{`foo = $[s mbol]`, []interface{}{"foo", tokenEqual, "$[s mbol]"}}, // function call
+	{`foo = $[ s]`, []interface{}{"foo", tokenEqual, errors.New(`at "foo = $[ ": character invalid in symbol: ' '`)}},
+	{`foo = $[s [m]bol]`, []interface{}{"foo", tokenEqual, "$[s [m]bol]"}},
+	{`foo = $[s [mbol]`, []interface{}{"foo", tokenEqual, errors.New(`at "...oo = $[s [mbol]": premature end of input`)}},
 	{`foo = $[s[mbol]`, []interface{}{"foo", tokenEqual, errors.New(`at "foo = $[s[": character invalid in symbol: '['`)}},
 	{`foo = $[s=mbol]`, []interface{}{"foo", tokenEqual, errors.New(`at "foo = $[s=": character invalid in symbol: '='`)}},
 	{`foo = $[s\mbol]`, []interface{}{"foo", tokenEqual, errors.New(`at "foo = $[s\": character invalid in symbol: '\'`)}},
@@ -127,6 +130,29 @@ var tokTestData = []struct {
 
 	{`\$[ a \]b] = x`, []interface{}{`$ a ]b`, tokenEqual, "x"}},
 	{`foo= [b$ c]`, []interface{}{`foo`, tokenEqual, errors.New(`at "foo= [b$ ": character invalid in symbol: ' '`)}},
+
+	{`$[x:-default]`, []interface{}{"default"}},
+	{`$[x:-]`, []interface{}{""}},
+	{`$[x:-a b] c`, []interface{}{"a b", "c"}},
+	{`$[x:-[a]]`, []interface{}{"[a]"}},
+	{`$[x:-[[a]]]`, []interface{}{"[[a]]"}},
+	{`$[x:-a\]b]`, []interface{}{"a]b"}},
+	{`$[x:-$[_y]]`, []interface{}{"value of _y"}},
+	{`$[x:-$[y:-$[_z]]]`, []interface{}{"value of _z"}},
+	{`$[x:-$[y]]`, []interface{}{"$[y]"}},
+	{`$[_x:-default]`, []interface{}{"value of _x"}},
+	{`foo=a$[x:-b]c`, []interface{}{"foo", tokenEqual, "abc"}},
+	{`$[x:+alt]`, []interface{}{""}},
+	{`$[_x:+alt]`, []interface{}{"alt"}},
+	{`$[_x:+$[_y]]`, []interface{}{"value of _y"}},
+	{`$[_x:?]`, []interface{}{"value of _x"}},
+	{`$[x:?]`, []interface{}{errors.New(`at "$[x:?]": symbol "x" undefined`)}},
+	{`$[x:?x is required]`, []interface{}{errors.New(`at "...?x is required]": symbol "x" undefined: x is required`)}},
+	{`$[x:=a]`, []interface{}{errors.New(`at "$[x:=": invalid modifier ':=' in symbol reference`)}},
+	{`$[x:`, []interface{}{errors.New(`at "$[x:": premature end of input`)}},
+	{`$[x:-[a]`, []interface{}{errors.New(`at "$[x:-[a]": premature end of input`)}},
+	{`$[:-a]`, []interface{}{errors.New(`at "$[:": character invalid in symbol: ':'`)}},
+	{`$[ERROR:-a]`, []interface{}{errors.New(`at "$[ERROR:-a]": error resolving "ERROR": (simulated error)`)}},
 }
 
 func TestTokenizerOnGenericData(t *testing.T) {
@@ -0,0 +1,99 @@
+package args
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Source is a layer of input parsed by Parser.ParseSources. Sources are
+// created by FileSource, FSSource, EnvSource, ArgsSource and StringSource.
+type Source struct {
+	name     string
+	optional bool
+	parse    func(a *Parser) error
+}
+
+// Optional returns a copy of the source which is silently skipped if its file
+// does not exist. It has no effect on sources not reading a file.
+func (s Source) Optional() Source {
+	s.optional = true
+	return s
+}
+
+// FileSource returns a source reading the named file of the operating system.
+// Relative file names in the file are resolved as for include.
+func FileSource(name string) Source {
+	return Source{name: name, parse: func(a *Parser) error {
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(abs)
+		if err != nil {
+			return err
+		}
+		return a.parseFile(data, includedFile{key: abs, name: name, os: true})
+	}}
+}
+
+// FSSource returns a source reading the named file of a file system. The name
+// must be a valid file system path as described in io/fs.
+func FSSource(fsys fs.FS, name string) Source {
+	return Source{name: name, parse: func(a *Parser) error {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		return a.parseFile(data, includedFile{key: name, name: name})
+	}}
+}
+
+// EnvSource returns a source taking values from the environment variables
+// bound to parameters (see Param.Env and Parser.SetEnvPrefix).
+func EnvSource() Source {
+	return Source{name: "environment", parse: func(a *Parser) error {
+		return a.environment(false)
+	}}
+}
+
+// ArgsSource returns a source parsing arguments joined with a blank, like
+// Parser.ParseStrings. It is typically used with os.Args[1:].
+func ArgsSource(args []string) Source {
+	return Source{name: "arguments", parse: func(a *Parser) error {
+		return a.parseBytes([]byte(strings.Join(args, " ")))
+	}}
+}
+
+// StringSource returns a source parsing s. The name identifies the source in
+// error messages.
+func StringSource(name, s string) Source {
+	return Source{name: name, parse: func(a *Parser) error {
+		return a.parseBytes([]byte(s))
+	}}
+}
+
+// parseFile parses the data of a file read by a source.
+func (a *Parser) parseFile(data []byte, file includedFile) error {
+	a.cycle.push(file)
+	defer a.cycle.pop()
+	return a.parseBytes(trimBOM(data))
+}
+
+// parseSource parses a source, decorating any error with the source name.
+func (a *Parser) parseSource(s Source) error {
+	err := s.parse(a)
+	switch {
+	case err == nil:
+		return nil
+	case s.optional && errors.Is(err, fs.ErrNotExist):
+		return nil
+	}
+	if _, ok := err.(limitError); ok {
+		return err
+	}
+	return fmt.Errorf(`source "%s": %v`, s.name, err)
+}
@@ -0,0 +1,77 @@
+package args_test
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jpvetterli/args"
+)
+
+func TestSources(t *testing.T) {
+	os.Setenv("ARGS_TEST_LEVEL", "4")
+	defer os.Unsetenv("ARGS_TEST_LEVEL")
+	fsys := fstest.MapFS{
+		"etc/tool.args": {Data: []byte("level=2 paths=/etc paths=/usr tags=x $S=system")},
+	}
+	a := getParser()
+	foo, bar, level, name := "", "", 0, ""
+	var paths, tags []string
+	a.Def("foo", &foo)
+	a.Def("bar", &bar)
+	a.Def("level", &level).Env("ARGS_TEST_LEVEL")
+	a.Def("name", &name).Opt()
+	a.Def("paths", &paths)
+	a.Def("tags", &tags).LayerReplace()
+	a.AddSource(
+		args.StringSource("defaults", "level=1 paths=/opt tags=[a] $S=defaults"),
+		args.FSSource(fsys, "etc/tool.args"),
+		args.FileSource("testdata/include.test"),
+		args.FileSource("testdata/missing.test").Optional(),
+		args.EnvSource(),
+		args.ArgsSource([]string{"tags=y", "tags=z", "name=$[S]"}),
+	)
+	if err := a.ParseSources(); err != nil {
+		t.Fatal(err)
+	}
+	if foo != "value of foo" || bar != "value of bar" || level != 4 || name != "defaults" {
+		t.Errorf("unexpected values: %s, %s, %d, %s", foo, bar, level, name)
+	}
+	if len(paths) != 3 || paths[0] != "/opt" || paths[2] != "/usr" {
+		t.Errorf("unexpected paths: %v", paths)
+	}
+	if len(tags) != 2 || tags[0] != "y" || tags[1] != "z" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
+func TestSourcesErrors(t *testing.T) {
+	a := getParser()
+	level := 0
+	a.Def("level", &level)
+	a.AddSource(args.StringSource("defaults", "level=x"))
+	if err := matchErrorMessage(a.ParseSources(), `source "defaults": Parse error on level: strconv.ParseInt: parsing "x": invalid syntax`); err != nil {
+		t.Error(err.Error())
+	}
+
+	a = getParser()
+	a.Def("level", &level)
+	a.AddSource(args.FSSource(fstest.MapFS{}, "tool.args"))
+	if err := matchErrorMessage(a.ParseSources(), `source "tool.args": open tool.args: file does not exist`); err != nil {
+		t.Error(err.Error())
+	}
+
+	a = getParser()
+	a.Def("level", &level)
+	a.AddSource(args.StringSource("defaults", ""))
+	if err := matchErrorMessage(a.ParseSources(), `Parse error on level: mandatory parameter not set`); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestSourcesLayerReplacePanic(t *testing.T) {
+	a := getParser()
+	defer panicHandler(`cannot replace values of "x" by layer (only slice parameters can)`, t)
+	x := 0
+	a.Def("x", &x).LayerReplace()
+}
@@ -1,7 +1,12 @@
 package args
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type resolver interface {
@@ -17,19 +22,41 @@ func (e cycleError) Error() string {
 
 }
 
+// mask is shown instead of secret values.
+const mask = "***"
+
+// maskError returns err with all non-empty values replaced with mask.
+func maskError(err error, values ...string) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	for _, v := range values {
+		if len(v) > 0 {
+			msg = strings.ReplaceAll(msg, v, mask)
+		}
+	}
+	return errors.New(msg)
+}
+
 // symval encapsulates a symbol table value.
 // Its zero value is the initial state.
 type symval struct {
 	resolved bool
+	secret   bool // masked in output
 	s        string
 }
 
 // symtab is a lazy symbol table. Values are resolved when needed, and resolving
 // a value can trigger the resolution of another one. All symbols use the same
-// prefix, available in config.
+// prefix, available in config. Scopes contain local symbols, like the arguments
+// of a macro. They shadow the symbols of the table and of outer scopes. When
+// the table is scoped, symbols are defined in the innermost scope.
 type symtab struct {
 	config *Config
 	table  map[string]*symval
+	scopes []map[string]*symval
+	scoped bool
 	cycle  map[string]bool
 }
 
@@ -46,26 +73,215 @@ func newSymtab(config *Config) symtab {
 // the syntax of a symbol definition. If the entry is already present it is
 // left untouched. This behavior is known as "first wins". The method returns
 // false if symbol does not agree with the syntax. The syntax is described in
-// detail in the package documentation.
-func (t *symtab) put(s, value string) bool {
+// detail in the package documentation. It returns an error if the symbol table
+// is full. When the table is scoped, the entry is added to the innermost scope,
+// unless the symbol is visible in any scope.
+func (t *symtab) put(s, value string) (bool, error) {
+	return t.putSecret(s, value, false)
+}
+
+// putSecret is like put, and marks a new entry as secret if secret is true.
+func (t *symtab) putSecret(s, value string, secret bool) (bool, error) {
 	r := []rune(s)
 	// symbol if 2 or more characters starting with prefix but not prefix+prefix
 	prefix := t.config.GetSpecial(SpecSymbolPrefix)
 	if len(r) > 1 && r[0] == prefix && r[1] != prefix {
-		sym := string(r[1:])
-		if _, ok := t.table[sym]; !ok {
-			// initially not resolved
-			t.table[sym] = &symval{s: value}
+		// initially not resolved
+		_, err := t.define(string(r[1:]), &symval{s: value, secret: secret})
+		return true, err
+	}
+	return false, nil
+}
+
+// define adds an entry for symbol to the symbol table, or to the innermost
+// scope, like put, and returns true. If the symbol is already visible the entry
+// is left untouched and the method returns false.
+func (t *symtab) define(symbol string, sv *symval) (bool, error) {
+	table := t.table
+	if t.scoped && len(t.scopes) > 0 {
+		if v, _ := t.lookup(symbol); v != nil {
+			return false, nil
 		}
-		return true
+		table = t.scopes[len(t.scopes)-1]
+	}
+	if _, ok := table[symbol]; ok {
+		return false, nil
+	}
+	if max := t.config.limits[LimitSymbols]; max > 0 && t.size() >= max {
+		return false, fmt.Errorf(`cannot define "%c%s": number of symbols exceeds limit of %d`, t.config.GetSpecial(SpecSymbolPrefix), symbol, max)
 	}
-	return false
+	table[symbol] = sv
+	return true, nil
+}
+
+// export copies a symbol visible in a scope to the table, unless already
+// present. If possible the resolved value is copied. It returns false if the
+// symbol is not defined.
+func (t *symtab) export(symbol string) (bool, error) {
+	sv, err := t.get(symbol)
+	if err != nil || sv == nil {
+		return false, err
+	}
+	if _, ok := t.table[symbol]; !ok {
+		if !sv.resolved {
+			sv, _ = t.lookup(symbol)
+		}
+		t.table[symbol] = &symval{resolved: sv.resolved, secret: sv.secret, s: sv.s}
+	}
+	return true, nil
+}
+
+// size returns the number of symbols in the table and in all scopes.
+func (t *symtab) size() int {
+	n := len(t.table)
+	for _, scope := range t.scopes {
+		n += len(scope)
+	}
+	return n
+}
+
+// pushScope adds an innermost scope with local symbols.
+func (t *symtab) pushScope(scope map[string]*symval) {
+	t.scopes = append(t.scopes, scope)
+}
+
+// popScope removes the innermost scope and its local symbols.
+func (t *symtab) popScope() {
+	t.scopes = t.scopes[:len(t.scopes)-1]
+}
+
+// lookup returns the symval for a symbol, or nil, without resolving it. It
+// returns true if the symbol is local to the innermost scope or if there is no
+// scope.
+func (t *symtab) lookup(symbol string) (*symval, bool) {
+	for i := len(t.scopes) - 1; i >= 0; i-- {
+		if sv, ok := t.scopes[i][symbol]; ok {
+			return sv, i == len(t.scopes)-1
+		}
+	}
+	return t.table[symbol], len(t.scopes) == 0
+}
+
+// names returns the names of all visible symbols, sorted.
+func (t *symtab) names() []string {
+	visible := make(map[string]bool, len(t.table))
+	for n := range t.table {
+		visible[n] = true
+	}
+	for _, scope := range t.scopes {
+		for n := range scope {
+			visible[n] = true
+		}
+	}
+	names := make([]string, 0, len(visible))
+	for n := range visible {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// secrets returns the values of all secret symbols, longest first.
+func (t *symtab) secrets() []string {
+	var values []string
+	add := func(scope map[string]*symval) {
+		for _, v := range scope {
+			if v.secret && len(v.s) > 0 {
+				values = append(values, v.s)
+			}
+		}
+	}
+	add(t.table)
+	for _, scope := range t.scopes {
+		add(scope)
+	}
+	longest(values)
+	return values
+}
+
+// longest sorts s by decreasing length.
+func longest(s []string) {
+	sort.Slice(s, func(i, j int) bool { return len(s[i]) > len(s[j]) })
+}
+
+// maskSecrets returns err with the values of secret symbols masked, unless it
+// is a limit error, which never includes values. When words is true, because
+// the input which caused the error included a secret value, which operators
+// and parameters may have split, the words of secret values are also masked
+// where they are not part of a longer word.
+func (t *symtab) maskSecrets(err error, words bool) error {
+	if _, ok := err.(limitError); ok {
+		return err
+	}
+	values := t.secrets()
+	if len(values) == 0 {
+		return err
+	}
+	err = maskError(err, values...)
+	if !words {
+		return err
+	}
+	var w []string
+	for _, v := range values {
+		w = append(w, strings.Fields(v)...)
+	}
+	longest(w)
+	msg := err.Error()
+	for _, v := range w {
+		msg = maskWord(msg, v)
+	}
+	return errors.New(msg)
+}
+
+// maskWord replaces the occurrences of w in s which are neither preceded nor
+// followed by a letter or a digit.
+func maskWord(s, w string) string {
+	isAlnum := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	var b strings.Builder
+	for {
+		i := strings.Index(s, w)
+		if i < 0 {
+			break
+		}
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(s[i+len(w):])
+		b.WriteString(s[:i])
+		if i > 0 && isAlnum(before) || i+len(w) < len(s) && isAlnum(after) {
+			b.WriteString(w)
+		} else {
+			b.WriteString(mask)
+		}
+		s = s[i+len(w):]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// maskString returns s with the values of secret symbols masked.
+func (t *symtab) maskString(s string) string {
+	for _, v := range t.secrets() {
+		s = strings.ReplaceAll(s, v, mask)
+	}
+	return s
+}
+
+// remove removes a symbol from the innermost scope where it is found, or from
+// the table.
+func (t *symtab) remove(symbol string) {
+	for i := len(t.scopes) - 1; i >= 0; i-- {
+		if _, ok := t.scopes[i][symbol]; ok {
+			delete(t.scopes[i], symbol)
+			return
+		}
+	}
+	delete(t.table, symbol)
 }
 
 // get returns the address of the symval for a symbol in the symbol table. It
 // returns nil and no error when the symbol is not in the table.  It resolves
 // the symbol when not done yet. It returns nil and an error when a cyclical
-// dependency is detected. The method updates the symbol table.
+// dependency is detected. The method updates the symbol table, except when the
+// resolved value could depend on local symbols of an inner scope.
 func (t *symtab) get(symbol string) (value *symval, err error) {
 	if _, ok := t.cycle[symbol]; ok {
 		return nil, cycleError{s: symbol}
@@ -74,8 +290,11 @@ func (t *symtab) get(symbol string) (value *symval, err error) {
 	defer func() {
 		delete(t.cycle, symbol)
 	}()
-	sv, ok := t.table[symbol]
-	if !ok {
+	if isCall(symbol) {
+		return t.call(symbol)
+	}
+	sv, cacheable := t.lookup(symbol)
+	if sv == nil {
 		return nil, nil
 	}
 	if sv.resolved {
@@ -90,11 +309,24 @@ func (t *symtab) get(symbol string) (value *symval, err error) {
 	token, sv1, err := tkz.next()
 
 	if err != nil {
+		if sv.secret {
+			if _, ok := err.(cycleError); !ok {
+				return nil, fmt.Errorf(`invalid value of secret symbol "%s"`, symbol)
+			}
+		}
 		return nil, err
 	}
 	if token != tokenString {
+		if sv.secret {
+			return nil, fmt.Errorf(`recursive scan failed: %s`, mask)
+		}
 		return nil, fmt.Errorf(`recursive scan failed: %s`, quoted)
 	}
-	sv.resolved = sv1.resolved
+	sv1.secret = sv1.secret || sv.secret
+	if sv1.resolved && cacheable {
+		sv.resolved = true
+		sv.secret = sv1.secret
+		sv.s = sv1.s
+	}
 	return sv1, nil
 }
@@ -54,6 +54,19 @@ func TestGetResolvedValue(t *testing.T) {
 	}
 }
 
+func TestGetResolvedValueTwice(t *testing.T) {
+	table := newTestingSymtab('$')
+	table.put("$a4", "a $[b4]")
+	table.put("$b4", "B")
+	expected := "a B"
+	for i := 0; i < 2; i++ {
+		v, _ := table.get("a4")
+		if v.s != expected {
+			t.Errorf(`found "%s", expected "%s"`, v.s, expected)
+		}
+	}
+}
+
 func TestGetCycle(t *testing.T) {
 	table := newTestingSymtab('$')
 	table.put("$a3", "a $[b3] e")